@@ -0,0 +1,263 @@
+package gonn
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Activation is the activation function applied to the output of a layer.
+type Activation interface {
+	// Apply returns the activation of the pre-activation values z.
+	Apply(z []float64) []float64
+	// Backward returns the gradient with respect to the pre-activation values
+	// z given the activated output y = Apply(z) and the gradient with respect
+	// to y.
+	Backward(z, y, grad []float64) []float64
+}
+
+type elementwise struct {
+	f  func(float64) float64
+	df func(float64) float64
+}
+
+// NewActivation returns an element-wise activation built from a function and
+// its derivative, both taking the pre-activation value.
+func NewActivation(f, df func(float64) float64) Activation {
+	return &elementwise{f: f, df: df}
+}
+
+// inPlaceActivation is implemented by activations that can write their result
+// into dst, which may be z itself, without allocating.
+type inPlaceActivation interface {
+	ApplyTo(dst, z []float64)
+}
+
+func (a *elementwise) Apply(z []float64) []float64 {
+	y := make([]float64, len(z))
+	a.ApplyTo(y, z)
+	return y
+}
+
+func (a *elementwise) ApplyTo(dst, z []float64) {
+	for i := range z {
+		dst[i] = a.f(z[i])
+	}
+}
+
+func (a *elementwise) Backward(z, y, grad []float64) []float64 {
+	dz := make([]float64, len(z))
+	for i := range z {
+		dz[i] = grad[i] * a.df(z[i])
+	}
+	return dz
+}
+
+type softmax struct{}
+
+func (softmax) Apply(z []float64) []float64 {
+	y := make([]float64, len(z))
+	softmax{}.ApplyTo(y, z)
+	return y
+}
+
+func (softmax) ApplyTo(dst, z []float64) {
+	if len(z) == 0 {
+		return
+	}
+	max := z[0]
+	for _, v := range z {
+		if v > max {
+			max = v
+		}
+	}
+	sum := 0.0
+	for i, v := range z {
+		dst[i] = math.Exp(v - max)
+		sum += dst[i]
+	}
+	for i := range z {
+		dst[i] /= sum
+	}
+}
+
+func (softmax) Backward(z, y, grad []float64) []float64 {
+	dot := 0.0
+	for i := range y {
+		dot += grad[i] * y[i]
+	}
+	dz := make([]float64, len(y))
+	for i := range y {
+		dz[i] = y[i] * (grad[i] - dot)
+	}
+	return dz
+}
+
+var sigmoidActivation = NewActivation(sigmoid, sigmoidDerivative)
+
+var (
+	activationsMu sync.RWMutex
+	activations   = map[string]Activation{
+		"sigmoid":    sigmoidActivation,
+		"relu":       NewActivation(relu, reluDerivative),
+		"tanh":       NewActivation(math.Tanh, tanhDerivative),
+		"leaky_relu": NewActivation(leakyRelu, leakyReluDerivative),
+		"elu":        NewActivation(elu, eluDerivative),
+		"gelu":       NewActivation(gelu, geluDerivative),
+		"softplus":   NewActivation(softplus, sigmoid),
+		"swish":      NewActivation(swish, swishDerivative),
+		"linear":     NewActivation(linear, linearDerivative),
+		"softmax":    softmax{},
+	}
+)
+
+// RegisterActivation makes a user-defined element-wise activation available
+// under name, replacing any activation previously registered with that name.
+// df is the derivative of f with respect to its input.
+func RegisterActivation(name string, f, df func(float64) float64) {
+	activationsMu.Lock()
+	defer activationsMu.Unlock()
+	activations[name] = NewActivation(f, df)
+}
+
+// GetActivation returns the activation registered under name.
+func GetActivation(name string) (Activation, error) {
+	activationsMu.RLock()
+	defer activationsMu.RUnlock()
+	a, ok := activations[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown activation function: %q", name)
+	}
+	return a, nil
+}
+
+// activationName returns the name a is registered under, or false if a has not
+// been registered.
+func activationName(a Activation) (string, bool) {
+	activationsMu.RLock()
+	defer activationsMu.RUnlock()
+	for name, registered := range activations {
+		if registered == a {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// splitActivations splits a "hidden-output" activation pair such as
+// "relu-sigmoid". Registered names may themselves contain '-'.
+func splitActivations(pair string) (Activation, Activation, error) {
+	for i := 0; i < len(pair); i++ {
+		if pair[i] != '-' {
+			continue
+		}
+		hidden, err1 := GetActivation(pair[:i])
+		output, err2 := GetActivation(pair[i+1:])
+		if err1 == nil && err2 == nil {
+			return hidden, output, nil
+		}
+	}
+	if !strings.Contains(pair, "-") {
+		return nil, nil, fmt.Errorf("activation pair must be of the form \"hidden-output\": %q", pair)
+	}
+	return nil, nil, fmt.Errorf("unknown activation function pair: %q", pair)
+}
+
+func sigmoid(x float64) float64 {
+	return 1.0 / (1.0 + math.Exp(-x))
+}
+
+func sigmoidDerivative(x float64) float64 {
+	return sigmoid(x) * (1 - sigmoid(x))
+}
+
+func relu(x float64) float64 {
+	if x >= 0 {
+		return x
+	} else {
+		return 0
+	}
+}
+
+func reluDerivative(x float64) float64 {
+	if x >= 0 {
+		return 1
+	} else {
+		return 0
+	}
+}
+
+func tanhDerivative(x float64) float64 {
+	t := math.Tanh(x)
+	return 1 - t*t
+}
+
+const leakyReluSlope = 0.01
+
+func leakyRelu(x float64) float64 {
+	if x >= 0 {
+		return x
+	}
+	return leakyReluSlope * x
+}
+
+func leakyReluDerivative(x float64) float64 {
+	if x >= 0 {
+		return 1
+	}
+	return leakyReluSlope
+}
+
+func elu(x float64) float64 {
+	if x >= 0 {
+		return x
+	}
+	return math.Exp(x) - 1
+}
+
+func eluDerivative(x float64) float64 {
+	if x >= 0 {
+		return 1
+	}
+	return math.Exp(x)
+}
+
+// gelu uses the tanh approximation of the Gaussian error linear unit.
+const geluC = 0.7978845608028654 // sqrt(2/pi)
+
+func gelu(x float64) float64 {
+	return 0.5 * x * (1 + math.Tanh(geluC*(x+0.044715*x*x*x)))
+}
+
+func geluDerivative(x float64) float64 {
+	u := geluC * (x + 0.044715*x*x*x)
+	t := math.Tanh(u)
+	du := geluC * (1 + 3*0.044715*x*x)
+	return 0.5*(1+t) + 0.5*x*(1-t*t)*du
+}
+
+func softplus(x float64) float64 {
+	// log(1+e^x) without overflow for large x
+	if x > 0 {
+		return x + math.Log1p(math.Exp(-x))
+	}
+	return math.Log1p(math.Exp(x))
+}
+
+func swish(x float64) float64 {
+	return x * sigmoid(x)
+}
+
+func swishDerivative(x float64) float64 {
+	s := sigmoid(x)
+	return s + x*s*(1-s)
+}
+
+func linear(x float64) float64 {
+	return x
+}
+
+func linearDerivative(x float64) float64 {
+	return 1
+}
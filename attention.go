@@ -0,0 +1,446 @@
+package gonn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// AttentionMask reports whether the time step query may attend to the time
+// step key. A nil mask lets every step attend to every other step.
+type AttentionMask func(query, key int) bool
+
+// CausalMask lets every time step attend only to itself and earlier steps.
+func CausalMask(query, key int) bool {
+	return key <= query
+}
+
+// ScaledDotProductAttention returns softmax(q k^T / sqrt(d)) v, where q, k and
+// v hold one row per time step and d is the length of the rows of q and k.
+// Scores of pairs rejected by mask are excluded from the softmax.
+func ScaledDotProductAttention(q, k, v [][]float64, mask AttentionMask) [][]float64 {
+	output, _ := attend(q, k, v, mask)
+	return output
+}
+
+// attend returns the attention output together with the attention weights.
+func attend(q, k, v [][]float64, mask AttentionMask) ([][]float64, [][]float64) {
+	scores := MatMul(TensorFromRows(q), TensorFromRows(k).Transpose()).Scale(1 / math.Sqrt(float64(len(q[0]))))
+	weights := scores.Rows()
+	for i, row := range weights {
+		max := math.Inf(-1)
+		for j := range row {
+			if mask != nil && !mask(i, j) {
+				row[j] = math.Inf(-1)
+			}
+			max = math.Max(max, row[j])
+		}
+		// 全てマスクされた行は重みを 0 にする
+		if math.IsInf(max, -1) {
+			for j := range row {
+				row[j] = 0
+			}
+			continue
+		}
+		sum := 0.0
+		for j := range row {
+			row[j] = math.Exp(row[j] - max)
+			sum += row[j]
+		}
+		for j := range row {
+			row[j] /= sum
+		}
+	}
+	return MatMul(scores, TensorFromRows(v)).Rows(), weights
+}
+
+// attendBackward returns the gradients of q, k and v given the gradient of the
+// attention output and the weights returned by attend.
+func attendBackward(q, k, v, weights, grad [][]float64) ([][]float64, [][]float64, [][]float64) {
+	scale := 1 / math.Sqrt(float64(len(q[0])))
+	w := TensorFromRows(weights)
+	g := TensorFromRows(grad)
+	dv := MatMul(w.Transpose(), g)
+
+	// softmax の勾配: ds = w * (dw - sum(dw * w))
+	dw := MatMul(g, TensorFromRows(v).Transpose())
+	ds := Mul(w, Sub(dw, Mul(dw, w).Sum(1))).Scale(scale)
+	dq := MatMul(ds, TensorFromRows(k))
+	dk := MatMul(ds.Transpose(), TensorFromRows(q))
+	return dq.Rows(), dk.Rows(), dv.Rows()
+}
+
+// TimeDistributed applies a layer to every time step of sequences stored flat
+// with inputSize values per step.
+type TimeDistributed struct {
+	Layer     Layer
+	inputSize int
+	lengths   []int
+}
+
+// NewTimeDistributed returns a layer applying layer to every time step.
+func NewTimeDistributed(layer Layer, inputSize int) *TimeDistributed {
+	return &TimeDistributed{Layer: layer, inputSize: inputSize}
+}
+
+func (t *TimeDistributed) Forward(inputs [][]float64) [][]float64 {
+	steps, lengths := splitSteps(inputs, t.inputSize)
+	t.lengths = lengths
+	return joinSteps(t.Layer.Forward(steps), lengths)
+}
+
+func (t *TimeDistributed) Predict(inputs [][]float64) [][]float64 {
+	steps, lengths := splitSteps(inputs, t.inputSize)
+	return joinSteps(predictLayer(t.Layer, steps), lengths)
+}
+
+func (t *TimeDistributed) Backward(grads [][]float64) [][]float64 {
+	steps := [][]float64{}
+	for n, grad := range grads {
+		if t.lengths[n] > 0 {
+			size := len(grad) / t.lengths[n]
+			for i := 0; i < t.lengths[n]; i++ {
+				steps = append(steps, grad[i*size:(i+1)*size])
+			}
+		}
+	}
+	return joinSteps(t.Layer.Backward(steps), t.lengths)
+}
+
+func (t *TimeDistributed) Params() []*Param {
+	return t.Layer.Params()
+}
+
+func (t *TimeDistributed) wrapped() Layer {
+	return t.Layer
+}
+
+func (t *TimeDistributed) Buffers() [][][]float64 {
+	if b, ok := t.Layer.(Buffered); ok {
+		return b.Buffers()
+	}
+	return nil
+}
+
+// Replicate panics when the wrapped layer does not implement Replicator;
+// Fit checks this beforehand and returns an error instead.
+func (t *TimeDistributed) Replicate() Layer {
+	r, ok := t.Layer.(Replicator)
+	if !ok {
+		panic(fmt.Sprintf("layer %T does not support data-parallel training", t.Layer))
+	}
+	return NewTimeDistributed(r.Replicate(), t.inputSize)
+}
+
+// splitSteps returns the time steps of every sequence as one batch together
+// with the number of steps of every sequence.
+func splitSteps(inputs [][]float64, size int) ([][]float64, []int) {
+	steps := [][]float64{}
+	lengths := make([]int, len(inputs))
+	for n, input := range inputs {
+		lengths[n] = len(input) / size
+		for i := 0; i < lengths[n]; i++ {
+			steps = append(steps, input[i*size:(i+1)*size])
+		}
+	}
+	return steps, lengths
+}
+
+func joinSteps(steps [][]float64, lengths []int) [][]float64 {
+	outputs := make([][]float64, len(lengths))
+	for n, length := range lengths {
+		output := []float64{}
+		for _, step := range steps[:length] {
+			output = append(output, step...)
+		}
+		steps = steps[length:]
+		outputs[n] = output
+	}
+	return outputs
+}
+
+// MultiHeadAttention is self-attention over sequences of modelSize values per
+// time step. Every head attends with its own slice of the projected queries,
+// keys and values, and the heads are concatenated and projected back to
+// modelSize values.
+type MultiHeadAttention struct {
+	modelSize int
+	heads     int
+	mask      AttentionMask
+
+	query, key, value, output *TimeDistributed
+
+	cache []attentionCache
+}
+
+type attentionCache struct {
+	q, k, v, weights [][][]float64
+}
+
+// NewMultiHeadAttention returns a multi-head self-attention layer. modelSize
+// must be divisible by heads. mask may be nil.
+func NewMultiHeadAttention(modelSize, heads int, mask AttentionMask) *MultiHeadAttention {
+	return NewMultiHeadAttentionRand(modelSize, heads, mask, nil)
+}
+
+// NewMultiHeadAttentionRand is like NewMultiHeadAttention but draws the initial
+// weights from rng. A nil rng uses a shared source seeded with the current
+// time.
+func NewMultiHeadAttentionRand(modelSize, heads int, mask AttentionMask, rng *rand.Rand) *MultiHeadAttention {
+	if heads <= 0 || modelSize%heads != 0 {
+		panic(fmt.Sprintf("model size %d is not divisible by %d heads", modelSize, heads))
+	}
+	rng = randOrDefault(rng)
+	projection := func() *TimeDistributed {
+		return NewTimeDistributed(NewDenseRand(modelSize, modelSize, NewActivation(linear, linearDerivative), rng), modelSize)
+	}
+	return &MultiHeadAttention{
+		modelSize: modelSize,
+		heads:     heads,
+		mask:      mask,
+		query:     projection(),
+		key:       projection(),
+		value:     projection(),
+		output:    projection(),
+	}
+}
+
+func (m *MultiHeadAttention) Forward(inputs [][]float64) [][]float64 {
+	q := m.query.Forward(inputs)
+	k := m.key.Forward(inputs)
+	v := m.value.Forward(inputs)
+	attended, cache := m.attend(q, k, v)
+	m.cache = cache
+	return m.output.Forward(attended)
+}
+
+func (m *MultiHeadAttention) Predict(inputs [][]float64) [][]float64 {
+	q := m.query.Predict(inputs)
+	k := m.key.Predict(inputs)
+	v := m.value.Predict(inputs)
+	attended, _ := m.attend(q, k, v)
+	return m.output.Predict(attended)
+}
+
+// attend applies every head to every sequence and concatenates the heads.
+func (m *MultiHeadAttention) attend(q, k, v [][]float64) ([][]float64, []attentionCache) {
+	outputs := make([][]float64, len(q))
+	cache := make([]attentionCache, len(q))
+	for n := range q {
+		c := attentionCache{
+			q:       m.splitHeads(q[n]),
+			k:       m.splitHeads(k[n]),
+			v:       m.splitHeads(v[n]),
+			weights: make([][][]float64, m.heads),
+		}
+		heads := make([][][]float64, m.heads)
+		for h := 0; h < m.heads; h++ {
+			if len(c.q[h]) == 0 {
+				continue
+			}
+			heads[h], c.weights[h] = attend(c.q[h], c.k[h], c.v[h], m.mask)
+		}
+		outputs[n] = m.joinHeads(heads, len(q[n])/m.modelSize)
+		cache[n] = c
+	}
+	return outputs, cache
+}
+
+func (m *MultiHeadAttention) Backward(grads [][]float64) [][]float64 {
+	grads = m.output.Backward(grads)
+	dq := make([][]float64, len(grads))
+	dk := make([][]float64, len(grads))
+	dv := make([][]float64, len(grads))
+	for n, grad := range grads {
+		c := m.cache[n]
+		length := len(grad) / m.modelSize
+		gradHeads := m.splitHeads(grad)
+		q := make([][][]float64, m.heads)
+		k := make([][][]float64, m.heads)
+		v := make([][][]float64, m.heads)
+		for h := 0; h < m.heads; h++ {
+			if length == 0 {
+				continue
+			}
+			q[h], k[h], v[h] = attendBackward(c.q[h], c.k[h], c.v[h], c.weights[h], gradHeads[h])
+		}
+		dq[n] = m.joinHeads(q, length)
+		dk[n] = m.joinHeads(k, length)
+		dv[n] = m.joinHeads(v, length)
+	}
+	inputGrads := m.query.Backward(dq)
+	for n, grad := range m.key.Backward(dk) {
+		addTo(inputGrads[n], grad)
+	}
+	for n, grad := range m.value.Backward(dv) {
+		addTo(inputGrads[n], grad)
+	}
+	return inputGrads
+}
+
+// splitHeads splits a flat sequence into one matrix per head with a row per
+// time step.
+func (m *MultiHeadAttention) splitHeads(sequence []float64) [][][]float64 {
+	size := m.modelSize / m.heads
+	length := len(sequence) / m.modelSize
+	heads := make([][][]float64, m.heads)
+	for h := range heads {
+		heads[h] = make([][]float64, length)
+		for t := range heads[h] {
+			start := t*m.modelSize + h*size
+			heads[h][t] = sequence[start : start+size]
+		}
+	}
+	return heads
+}
+
+func (m *MultiHeadAttention) joinHeads(heads [][][]float64, length int) []float64 {
+	sequence := make([]float64, 0, length*m.modelSize)
+	for t := 0; t < length; t++ {
+		for _, head := range heads {
+			sequence = append(sequence, head[t]...)
+		}
+	}
+	return sequence
+}
+
+func (m *MultiHeadAttention) Params() []*Param {
+	params := []*Param{}
+	for _, p := range []*TimeDistributed{m.query, m.key, m.value, m.output} {
+		params = append(params, p.Params()...)
+	}
+	return params
+}
+
+func (m *MultiHeadAttention) Replicate() Layer {
+	return &MultiHeadAttention{
+		modelSize: m.modelSize,
+		heads:     m.heads,
+		mask:      m.mask,
+		query:     m.query.Replicate().(*TimeDistributed),
+		key:       m.key.Replicate().(*TimeDistributed),
+		value:     m.value.Replicate().(*TimeDistributed),
+		output:    m.output.Replicate().(*TimeDistributed),
+	}
+}
+
+// PositionalEncoding adds the sinusoidal position encodings of the original
+// Transformer to sequences of modelSize values per time step.
+type PositionalEncoding struct {
+	modelSize int
+}
+
+// NewPositionalEncoding returns a layer adding position encodings.
+func NewPositionalEncoding(modelSize int) *PositionalEncoding {
+	return &PositionalEncoding{modelSize: modelSize}
+}
+
+func (p *PositionalEncoding) Forward(inputs [][]float64) [][]float64 {
+	outputs := make([][]float64, len(inputs))
+	for n, input := range inputs {
+		output := make([]float64, len(input))
+		for i, x := range input {
+			t, d := i/p.modelSize, i%p.modelSize
+			angle := float64(t) / math.Pow(10000, float64(d-d%2)/float64(p.modelSize))
+			if d%2 == 0 {
+				output[i] = x + math.Sin(angle)
+			} else {
+				output[i] = x + math.Cos(angle)
+			}
+		}
+		outputs[n] = output
+	}
+	return outputs
+}
+
+func (p *PositionalEncoding) Predict(inputs [][]float64) [][]float64 {
+	return p.Forward(inputs)
+}
+
+func (p *PositionalEncoding) Backward(grads [][]float64) [][]float64 {
+	return grads
+}
+
+func (p *PositionalEncoding) Params() []*Param {
+	return nil
+}
+
+func (p *PositionalEncoding) Replicate() Layer {
+	return p
+}
+
+// TransformerEncoder is an encoder block of the Transformer: multi-head
+// self-attention and a position-wise feed-forward network with hiddenSize ReLU
+// units, each followed by a residual connection and layer normalization.
+type TransformerEncoder struct {
+	attention *MultiHeadAttention
+	norm1     *TimeDistributed
+	hidden    *TimeDistributed
+	output    *TimeDistributed
+	norm2     *TimeDistributed
+}
+
+// NewTransformerEncoder returns an encoder block for sequences of modelSize
+// values per time step. mask may be nil.
+func NewTransformerEncoder(modelSize, heads, hiddenSize int, mask AttentionMask) *TransformerEncoder {
+	return NewTransformerEncoderRand(modelSize, heads, hiddenSize, mask, nil)
+}
+
+// NewTransformerEncoderRand is like NewTransformerEncoder but draws the
+// initial weights from rng. A nil rng uses a shared source seeded with the
+// current time.
+func NewTransformerEncoderRand(modelSize, heads, hiddenSize int, mask AttentionMask, rng *rand.Rand) *TransformerEncoder {
+	rng = randOrDefault(rng)
+	return &TransformerEncoder{
+		attention: NewMultiHeadAttentionRand(modelSize, heads, mask, rng),
+		norm1:     NewTimeDistributed(NewLayerNorm(modelSize), modelSize),
+		hidden:    NewTimeDistributed(NewDense(modelSize, hiddenSize, NewActivation(relu, reluDerivative)).Initialize(HeUniform, nil, rng), modelSize),
+		output:    NewTimeDistributed(NewDenseRand(hiddenSize, modelSize, NewActivation(linear, linearDerivative), rng), hiddenSize),
+		norm2:     NewTimeDistributed(NewLayerNorm(modelSize), modelSize),
+	}
+}
+
+func (e *TransformerEncoder) Forward(inputs [][]float64) [][]float64 {
+	h := e.norm1.Forward(added(inputs, e.attention.Forward(inputs)))
+	return e.norm2.Forward(added(h, e.output.Forward(e.hidden.Forward(h))))
+}
+
+func (e *TransformerEncoder) Predict(inputs [][]float64) [][]float64 {
+	h := e.norm1.Predict(added(inputs, e.attention.Predict(inputs)))
+	return e.norm2.Predict(added(h, e.output.Predict(e.hidden.Predict(h))))
+}
+
+func (e *TransformerEncoder) Backward(grads [][]float64) [][]float64 {
+	grads = e.norm2.Backward(grads)
+	grads = added(grads, e.hidden.Backward(e.output.Backward(grads)))
+	grads = e.norm1.Backward(grads)
+	return added(grads, e.attention.Backward(grads))
+}
+
+func (e *TransformerEncoder) Params() []*Param {
+	params := e.attention.Params()
+	for _, layer := range []*TimeDistributed{e.norm1, e.hidden, e.output, e.norm2} {
+		params = append(params, layer.Params()...)
+	}
+	return params
+}
+
+func (e *TransformerEncoder) Replicate() Layer {
+	return &TransformerEncoder{
+		attention: e.attention.Replicate().(*MultiHeadAttention),
+		norm1:     e.norm1.Replicate().(*TimeDistributed),
+		hidden:    e.hidden.Replicate().(*TimeDistributed),
+		output:    e.output.Replicate().(*TimeDistributed),
+		norm2:     e.norm2.Replicate().(*TimeDistributed),
+	}
+}
+
+// added returns the element-wise sum of a and b.
+func added(a, b [][]float64) [][]float64 {
+	sum := make([][]float64, len(a))
+	for n := range a {
+		sum[n] = append([]float64(nil), a[n]...)
+		addTo(sum[n], b[n])
+	}
+	return sum
+}
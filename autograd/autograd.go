@@ -0,0 +1,264 @@
+// Package autograd is a small reverse-mode automatic differentiation engine on
+// top of gonn.Tensor. Operations on Variables are recorded on a Tape, and
+// Backward computes the gradient of a result with respect to every Variable it
+// depends on.
+package autograd
+
+import (
+	"fmt"
+	"math"
+
+	gonn "github.com/takoyaki-3/go-nn/v2"
+)
+
+// Tape records the operations applied to its Variables in order.
+type Tape struct {
+	nodes []*Variable
+}
+
+// NewTape returns an empty tape.
+func NewTape() *Tape {
+	return &Tape{}
+}
+
+// Variable is a tensor recorded on a tape. Grad holds the gradient computed
+// by the last Backward call, or nil when the Variable does not take part in it.
+type Variable struct {
+	Value *gonn.Tensor
+	Grad  *gonn.Tensor
+
+	tape     *Tape
+	constant bool
+	// backward propagates Grad to the operands of the operation.
+	backward func()
+}
+
+// Var records value as a variable whose gradient is wanted.
+func (t *Tape) Var(value *gonn.Tensor) *Variable {
+	return t.record(value, nil)
+}
+
+// Const records value as a constant. No gradient is computed for it.
+func (t *Tape) Const(value *gonn.Tensor) *Variable {
+	v := t.record(value, nil)
+	v.constant = true
+	return v
+}
+
+// Scalar records a constant holding v.
+func (t *Tape) Scalar(v float64) *Variable {
+	return t.Const(gonn.TensorFrom([]float64{v}))
+}
+
+func (t *Tape) record(value *gonn.Tensor, backward func()) *Variable {
+	v := &Variable{Value: value, tape: t, backward: backward}
+	t.nodes = append(t.nodes, v)
+	return v
+}
+
+// Backward computes the gradient of v, which must hold a single value, with
+// respect to every variable recorded before it on its tape. Gradients of
+// earlier Backward calls are discarded.
+func (v *Variable) Backward() {
+	if v.Value.Size() != 1 {
+		panic(fmt.Sprintf("autograd: backward from a tensor of shape %v", v.Value.Shape))
+	}
+	seed := gonn.NewTensor(v.Value.Shape...)
+	seed.Data[0] = 1
+	v.BackwardWith(seed)
+}
+
+// BackwardWith is like Backward but starts from grad, the gradient of some
+// scalar with respect to v, which must have the shape of v.
+func (v *Variable) BackwardWith(grad *gonn.Tensor) {
+	for _, n := range v.tape.nodes {
+		n.Grad = nil
+	}
+	v.Grad = grad.Clone()
+	// テープを逆順に辿れば、各ノードの勾配は使われる前に全て集まっている
+	for i := len(v.tape.nodes) - 1; i >= 0; i-- {
+		n := v.tape.nodes[i]
+		if n.Grad != nil && n.backward != nil {
+			n.backward()
+		}
+	}
+}
+
+// accumulate adds g, reduced to the shape of v, to the gradient of v.
+func (v *Variable) accumulate(g *gonn.Tensor) {
+	if v.constant {
+		return
+	}
+	g = reduceTo(g, v.Value.Shape)
+	if v.Grad == nil {
+		v.Grad = g.Clone()
+		return
+	}
+	v.Grad.AddInPlace(g)
+}
+
+// reduceTo sums g over the axes that were broadcast from shape.
+func reduceTo(g *gonn.Tensor, shape []int) *gonn.Tensor {
+	for len(g.Shape) > len(shape) {
+		g = g.Sum(0)
+		g = g.Reshape(g.Shape[1:]...)
+	}
+	for i := range shape {
+		if shape[i] == 1 && g.Shape[i] != 1 {
+			g = g.Sum(i)
+		}
+	}
+	return g
+}
+
+func (v *Variable) op(value *gonn.Tensor, backward func(out *Variable)) *Variable {
+	out := v.tape.record(value, nil)
+	out.backward = func() { backward(out) }
+	return out
+}
+
+// Add returns a + b with broadcasting.
+func Add(a, b *Variable) *Variable {
+	return a.op(gonn.Add(a.Value, b.Value), func(out *Variable) {
+		a.accumulate(out.Grad)
+		b.accumulate(out.Grad)
+	})
+}
+
+// Sub returns a - b with broadcasting.
+func Sub(a, b *Variable) *Variable {
+	return a.op(gonn.Sub(a.Value, b.Value), func(out *Variable) {
+		a.accumulate(out.Grad)
+		b.accumulate(out.Grad.Scale(-1))
+	})
+}
+
+// Mul returns the element-wise product of a and b with broadcasting.
+func Mul(a, b *Variable) *Variable {
+	return a.op(gonn.Mul(a.Value, b.Value), func(out *Variable) {
+		a.accumulate(gonn.Mul(out.Grad, b.Value))
+		b.accumulate(gonn.Mul(out.Grad, a.Value))
+	})
+}
+
+// Div returns the element-wise quotient of a and b with broadcasting.
+func Div(a, b *Variable) *Variable {
+	return a.op(gonn.Div(a.Value, b.Value), func(out *Variable) {
+		a.accumulate(gonn.Div(out.Grad, b.Value))
+		b.accumulate(gonn.Mul(out.Grad, gonn.Div(out.Value, b.Value)).Scale(-1))
+	})
+}
+
+// MatMul returns the matrix product of the 2D variables a and b.
+func MatMul(a, b *Variable) *Variable {
+	return a.op(gonn.MatMul(a.Value, b.Value), func(out *Variable) {
+		a.accumulate(gonn.MatMul(out.Grad, b.Value.Transpose()))
+		b.accumulate(gonn.MatMul(a.Value.Transpose(), out.Grad))
+	})
+}
+
+// Transpose swaps the last two axes of v.
+func Transpose(v *Variable) *Variable {
+	return v.op(v.Value.Transpose().Clone(), func(out *Variable) {
+		v.accumulate(out.Grad.Transpose().Clone())
+	})
+}
+
+// Scale returns v multiplied by s.
+func Scale(v *Variable, s float64) *Variable {
+	return v.op(v.Value.Scale(s), func(out *Variable) {
+		v.accumulate(out.Grad.Scale(s))
+	})
+}
+
+// Sum returns the sum of every value of v as a scalar.
+func Sum(v *Variable) *Variable {
+	return v.op(gonn.TensorFrom([]float64{v.Value.SumAll()}), func(out *Variable) {
+		v.accumulate(broadcastTo(out.Grad, v.Value.Shape))
+	})
+}
+
+// Mean returns the mean of every value of v as a scalar.
+func Mean(v *Variable) *Variable {
+	return Scale(Sum(v), 1/float64(v.Value.Size()))
+}
+
+// SumAxis returns the sums of v along axis, keeping the axis with size 1.
+func SumAxis(v *Variable, axis int) *Variable {
+	return v.op(v.Value.Sum(axis), func(out *Variable) {
+		v.accumulate(broadcastTo(out.Grad, v.Value.Shape))
+	})
+}
+
+func broadcastTo(g *gonn.Tensor, shape []int) *gonn.Tensor {
+	return gonn.Add(gonn.NewTensor(shape...), g)
+}
+
+// unary returns an element-wise function of v whose derivative df is given the
+// input and output values.
+func unary(v *Variable, f func(x float64) float64, df func(x, y float64) float64) *Variable {
+	value := v.Value.Apply(f)
+	return v.op(value, func(out *Variable) {
+		g := out.Grad.Clone()
+		x := v.Value.Contiguous()
+		for i := range g.Data {
+			g.Data[i] *= df(x.Data[i], value.Data[i])
+		}
+		v.accumulate(g)
+	})
+}
+
+// Neg returns -v.
+func Neg(v *Variable) *Variable {
+	return Scale(v, -1)
+}
+
+// Exp returns e to the power of every value of v.
+func Exp(v *Variable) *Variable {
+	return unary(v, math.Exp, func(x, y float64) float64 { return y })
+}
+
+// Log returns the natural logarithm of every value of v.
+func Log(v *Variable) *Variable {
+	return unary(v, math.Log, func(x, y float64) float64 { return 1 / x })
+}
+
+// Pow returns every value of v to the power of p.
+func Pow(v *Variable, p float64) *Variable {
+	return unary(v, func(x float64) float64 { return math.Pow(x, p) }, func(x, y float64) float64 {
+		return p * math.Pow(x, p-1)
+	})
+}
+
+// Sigmoid applies the logistic function to every value of v.
+func Sigmoid(v *Variable) *Variable {
+	return unary(v, func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }, func(x, y float64) float64 {
+		return y * (1 - y)
+	})
+}
+
+// Tanh applies the hyperbolic tangent to every value of v.
+func Tanh(v *Variable) *Variable {
+	return unary(v, math.Tanh, func(x, y float64) float64 { return 1 - y*y })
+}
+
+// ReLU applies max(0, x) to every value of v.
+func ReLU(v *Variable) *Variable {
+	return unary(v, func(x float64) float64 { return math.Max(0, x) }, func(x, y float64) float64 {
+		if x > 0 {
+			return 1
+		}
+		return 0
+	})
+}
+
+// Softmax applies the softmax function to every row of the 2D variable v.
+func Softmax(v *Variable) *Variable {
+	shifted := gonn.Sub(v.Value, v.Value.Max(1))
+	exp := shifted.Apply(math.Exp)
+	value := gonn.Div(exp, exp.Sum(1))
+	return v.op(value, func(out *Variable) {
+		dot := gonn.Mul(out.Grad, value).Sum(1)
+		v.accumulate(gonn.Mul(value, gonn.Sub(out.Grad, dot)))
+	})
+}
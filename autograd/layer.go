@@ -0,0 +1,129 @@
+package autograd
+
+import (
+	"math/rand"
+
+	gonn "github.com/takoyaki-3/go-nn/v2"
+)
+
+// Function computes the outputs of a layer for x, a batch with one row per
+// sample, from the values of its parameters.
+type Function func(x *Variable, params []*Variable) *Variable
+
+// Layer is a gonn.Layer whose forward pass is a Function and whose backward
+// pass is derived automatically, so it can be used in gonn.Sequential models
+// like any hand-written layer.
+type Layer struct {
+	params []*gonn.Param
+	f      Function
+
+	input     *Variable
+	output    *Variable
+	variables []*Variable
+}
+
+// NewLayer returns a layer computing f with the given parameters.
+func NewLayer(params []*gonn.Param, f Function) *Layer {
+	return &Layer{params: params, f: f}
+}
+
+func (l *Layer) Forward(inputs [][]float64) [][]float64 {
+	input, output, variables := l.forward(inputs)
+	l.input, l.output, l.variables = input, output, variables
+	return output.Value.Contiguous().Rows()
+}
+
+func (l *Layer) Predict(inputs [][]float64) [][]float64 {
+	_, output, _ := l.forward(inputs)
+	return output.Value.Contiguous().Rows()
+}
+
+func (l *Layer) forward(inputs [][]float64) (*Variable, *Variable, []*Variable) {
+	tape := NewTape()
+	input := tape.Var(gonn.TensorFromRows(inputs))
+	variables := make([]*Variable, len(l.params))
+	for i, p := range l.params {
+		variables[i] = tape.Var(gonn.TensorFromRows(p.Value))
+	}
+	return input, l.f(input, variables), variables
+}
+
+func (l *Layer) Backward(grads [][]float64) [][]float64 {
+	l.output.BackwardWith(gonn.TensorFromRows(grads))
+	for i, p := range l.params {
+		if g := l.variables[i].Grad; g != nil {
+			rows := g.Rows()
+			for r := range p.Grad {
+				for c := range p.Grad[r] {
+					p.Grad[r][c] += rows[r][c]
+				}
+			}
+		}
+	}
+	if l.input.Grad == nil {
+		return gonn.NewTensor(l.input.Value.Shape...).Rows()
+	}
+	return l.input.Grad.Rows()
+}
+
+func (l *Layer) Params() []*gonn.Param {
+	return l.params
+}
+
+// Replicate returns a layer sharing the parameter values but not the
+// gradients.
+func (l *Layer) Replicate() gonn.Layer {
+	params := make([]*gonn.Param, len(l.params))
+	for i, p := range l.params {
+		shared := *p
+		shared.Grad = gonn.NewTensor(len(p.Grad), len(p.Grad[0])).Rows()
+		params[i] = &shared
+	}
+	return NewLayer(params, l.f)
+}
+
+// NewDense returns a fully connected layer computing activation(x W + b) with
+// Xavier uniform weights and zero biases. A nil activation is the identity.
+// A nil rng uses a shared source seeded with the current time.
+func NewDense(inputSize, outputSize int, activation func(*Variable) *Variable, rng *rand.Rand) *Layer {
+	weights := &gonn.Param{Value: gonn.NewTensor(inputSize, outputSize).Rows(), Grad: gonn.NewTensor(inputSize, outputSize).Rows()}
+	bias := &gonn.Param{Value: gonn.NewTensor(1, outputSize).Rows(), Grad: gonn.NewTensor(1, outputSize).Rows()}
+	gonn.XavierUniform(weights.Value, inputSize, outputSize, rng)
+	return NewLayer([]*gonn.Param{weights, bias}, func(x *Variable, params []*Variable) *Variable {
+		z := Add(MatMul(x, params[0]), params[1])
+		if activation == nil {
+			return z
+		}
+		return activation(z)
+	})
+}
+
+// LossFunction computes the loss of the output y of a model for the target t,
+// both single rows. A result holding more than one value is summed.
+type LossFunction func(y, t *Variable) *Variable
+
+// Loss is a gonn.Loss whose gradient is derived automatically from a
+// LossFunction.
+type Loss struct {
+	f LossFunction
+}
+
+// NewLoss returns a loss computing f.
+func NewLoss(f LossFunction) Loss {
+	return Loss{f: f}
+}
+
+func (l Loss) Value(y, t []float64) float64 {
+	tape := NewTape()
+	return l.f(tape.Const(gonn.TensorFrom(y, 1, len(y))), tape.Const(gonn.TensorFrom(t, 1, len(t)))).Value.SumAll()
+}
+
+func (l Loss) Gradient(y, t []float64) []float64 {
+	tape := NewTape()
+	output := tape.Var(gonn.TensorFrom(append([]float64(nil), y...), 1, len(y)))
+	Sum(l.f(output, tape.Const(gonn.TensorFrom(t, 1, len(t))))).Backward()
+	if output.Grad == nil {
+		return make([]float64, len(y))
+	}
+	return output.Grad.Data
+}
@@ -0,0 +1,98 @@
+package autograd
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	gonn "github.com/takoyaki-3/go-nn/v2"
+)
+
+// gradCheckTolerance is the largest difference gonn.GradCheck may report for a
+// correct model.
+const gradCheckTolerance = 1e-6
+
+func TestGradCheckDense(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	model := gonn.NewSequential(
+		NewDense(3, 4, Tanh, rng),
+		NewDense(4, 2, Sigmoid, rng),
+	)
+	inputs := randomRows(rng, 4, 3)
+	checkGradients(t, model, inputs, randomRows(rng, 4, 2))
+}
+
+func TestGradCheckLayer(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	scale := &gonn.Param{Value: randomRows(rng, 1, 4), Grad: make([][]float64, 1)}
+	scale.Grad[0] = make([]float64, 4)
+	// 入力にも勾配が流れるよう、独自の層は全結合層の後に置く
+	model := gonn.NewSequential(
+		NewDense(3, 4, nil, rng),
+		NewLayer([]*gonn.Param{scale}, func(x *Variable, params []*Variable) *Variable {
+			return Softmax(Mul(Exp(Scale(x, 0.5)), params[0]))
+		}),
+	)
+	inputs := randomRows(rng, 4, 3)
+	checkGradients(t, model, inputs, randomRows(rng, 4, 4))
+}
+
+func TestGradCheckLoss(t *testing.T) {
+	for name, f := range map[string]LossFunction{
+		"scalar": func(y, t *Variable) *Variable {
+			return Mean(Pow(Sub(y, t), 2))
+		},
+		"vector": func(y, t *Variable) *Variable {
+			return Mul(Neg(t), Log(y))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			model := gonn.NewSequential(
+				NewDense(3, 4, Tanh, rng),
+				NewDense(4, 2, Sigmoid, rng),
+			)
+			model.SetLossFunction(NewLoss(f))
+			inputs := randomRows(rng, 4, 3)
+			checkGradients(t, model, inputs, randomRows(rng, 4, 2))
+		})
+	}
+}
+
+// TestLossSumsVectors checks that Value and Gradient both sum a loss function
+// returning one value per output.
+func TestLossSumsVectors(t *testing.T) {
+	l := NewLoss(func(y, t *Variable) *Variable {
+		return Pow(Sub(y, t), 2)
+	})
+	y, target := []float64{1, 2, 3}, []float64{0, 2, 5}
+	if got := l.Value(y, target); got != 5 {
+		t.Errorf("Value = %v, want 5", got)
+	}
+	want := []float64{2, 0, -4}
+	for i, g := range l.Gradient(y, target) {
+		if math.Abs(g-want[i]) > 1e-12 {
+			t.Errorf("Gradient = %v, want %v", l.Gradient(y, target), want)
+			break
+		}
+	}
+}
+
+func checkGradients(t *testing.T, model *gonn.Sequential, inputs, targets [][]float64) {
+	t.Helper()
+	if diff := gonn.GradCheck(model, inputs, targets); diff > gradCheckTolerance {
+		t.Errorf("GradCheck = %g, want at most %g", diff, gradCheckTolerance)
+	}
+}
+
+// randomRows returns n rows of size values in (0, 1).
+func randomRows(rng *rand.Rand, n, size int) [][]float64 {
+	rows := make([][]float64, n)
+	for i := range rows {
+		rows[i] = make([]float64, size)
+		for j := range rows[i] {
+			rows[i][j] = rng.Float64()
+		}
+	}
+	return rows
+}
@@ -0,0 +1,121 @@
+package gonn
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// EpochMetrics summarizes one epoch of training.
+type EpochMetrics struct {
+	Epoch int `json:"epoch"`
+	// Loss is the average loss over the training samples.
+	Loss float64 `json:"loss"`
+	// Accuracy is the percentage of training samples whose largest output
+	// matches a target of 1.
+	Accuracy float64 `json:"accuracy"`
+	// LearningRate is the learning rate of the last optimizer step.
+	LearningRate float64 `json:"learningRate"`
+	// HasValidation reports whether the validation metrics are set.
+	HasValidation      bool    `json:"hasValidation"`
+	ValidationLoss     float64 `json:"validationLoss"`
+	ValidationAccuracy float64 `json:"validationAccuracy"`
+}
+
+// History holds the metrics of every epoch of a training run.
+type History struct {
+	Epochs []EpochMetrics `json:"epochs"`
+	// BestEpoch is the epoch with the lowest monitored loss.
+	BestEpoch int `json:"bestEpoch"`
+}
+
+// Loss returns the training loss of every epoch.
+func (h *History) Loss() []float64 {
+	loss := make([]float64, len(h.Epochs))
+	for i, e := range h.Epochs {
+		loss[i] = e.Loss
+	}
+	return loss
+}
+
+// ValidationLoss returns the validation loss of every epoch.
+func (h *History) ValidationLoss() []float64 {
+	loss := make([]float64, len(h.Epochs))
+	for i, e := range h.Epochs {
+		loss[i] = e.ValidationLoss
+	}
+	return loss
+}
+
+// Accuracy returns the training accuracy of every epoch.
+func (h *History) Accuracy() []float64 {
+	accuracy := make([]float64, len(h.Epochs))
+	for i, e := range h.Epochs {
+		accuracy[i] = e.Accuracy
+	}
+	return accuracy
+}
+
+// Callback receives events during Fit. OnEpochEnd returns true to stop
+// training after the current epoch.
+type Callback interface {
+	OnEpochBegin(epoch int)
+	OnBatchEnd(epoch, batch int, loss float64)
+	OnEpochEnd(metrics EpochMetrics) bool
+	OnTrainEnd(history *History)
+}
+
+// CallbackFuncs implements Callback with optional functions; nil functions are
+// skipped.
+type CallbackFuncs struct {
+	EpochBegin func(epoch int)
+	BatchEnd   func(epoch, batch int, loss float64)
+	EpochEnd   func(metrics EpochMetrics) bool
+	TrainEnd   func(history *History)
+}
+
+func (c CallbackFuncs) OnEpochBegin(epoch int) {
+	if c.EpochBegin != nil {
+		c.EpochBegin(epoch)
+	}
+}
+
+func (c CallbackFuncs) OnBatchEnd(epoch, batch int, loss float64) {
+	if c.BatchEnd != nil {
+		c.BatchEnd(epoch, batch, loss)
+	}
+}
+
+func (c CallbackFuncs) OnEpochEnd(metrics EpochMetrics) bool {
+	if c.EpochEnd != nil {
+		return c.EpochEnd(metrics)
+	}
+	return false
+}
+
+func (c CallbackFuncs) OnTrainEnd(history *History) {
+	if c.TrainEnd != nil {
+		c.TrainEnd(history)
+	}
+}
+
+// NoLogger disables the built-in progress output of Fit.
+var NoLogger Callback = CallbackFuncs{}
+
+// NewLogger returns a callback writing the metrics of every epoch to w. It is
+// the logger Fit uses, writing to standard output, when none is configured.
+func NewLogger(w io.Writer) Callback {
+	return CallbackFuncs{
+		EpochEnd: func(metrics EpochMetrics) bool {
+			if metrics.HasValidation {
+				fmt.Fprintf(w, "epoch: %d, loss: %f, accuracy: %f, validation loss: %f, validation accuracy: %f\n",
+					metrics.Epoch, metrics.Loss, metrics.Accuracy, metrics.ValidationLoss, metrics.ValidationAccuracy)
+			} else {
+				fmt.Fprintf(w, "epoch: %d, loss: %f, accuracy: %f\n", metrics.Epoch, metrics.Loss, metrics.Accuracy)
+			}
+			return false
+		},
+	}
+}
+
+var defaultLogger = NewLogger(os.Stdout)
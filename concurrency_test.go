@@ -0,0 +1,441 @@
+package gonn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// These tests are meant to be run with the race detector:
+//
+//	go test -race -run Concurrent
+
+func TestConcurrentNeuralNetwork(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	inputs, outputs := classification(rng, 64, 8, 4)
+	nn := NewNeuralNetworkRand(8, 16, 4, "relu-softmax", rng)
+
+	dir := t.TempDir()
+	saved := filepath.Join(dir, "nn.json")
+	savedBinary := filepath.Join(dir, "nn.gob")
+	if err := nn.SaveWeights(saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := nn.SaveWeightsBinary(savedBinary); err != nil {
+		t.Fatal(err)
+	}
+
+	runConcurrently(t, nnReaders(t, nn, inputs, dir),
+		func() {
+			fit(t, nn.Sequential, inputs, outputs, 8, 2)
+		},
+		func() {
+			for i := 0; i < 10; i++ {
+				nn.Mutate(0.1, rand.New(rand.NewSource(int64(i))))
+				if err := nn.LoadWeights(saved); err != nil {
+					t.Error(err)
+				}
+				if err := nn.LoadWeightsBinary(savedBinary); err != nil {
+					t.Error(err)
+				}
+				if err := nn.SetActivationFunction("tanh-softmax"); err != nil {
+					t.Error(err)
+				}
+			}
+		},
+	)
+}
+
+// TestConcurrentNeuralNetworkResize loads weights of another hidden size, which
+// replaces the layers, while the network serves inference, and checks that
+// every result comes from one of the two weight sets.
+func TestConcurrentNeuralNetworkResize(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	inputs, _ := classification(rng, 16, 8, 4)
+	small := NewNeuralNetworkRand(8, 12, 4, "relu-softmax", rng)
+	large := NewNeuralNetworkRand(8, 16, 4, "relu-softmax", rng)
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "small.json"), filepath.Join(dir, "large.json")}
+	for i, nn := range []*NeuralNetwork{small, large} {
+		if err := nn.SaveWeights(paths[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nn := NewNeuralNetworkRand(8, 16, 4, "relu-softmax", rng)
+	if err := nn.LoadWeights(paths[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][][]float64{small.ForwardBatch(inputs), large.ForwardBatch(inputs)}
+	oneOf := func(name string, n int, output []float64) {
+		for _, want := range expected {
+			if equalWithin(output, want[n], 1e-12) {
+				return
+			}
+		}
+		t.Errorf("%s of input %d = %v, want %v or %v", name, n, output, expected[0][n], expected[1][n])
+	}
+	readers := []func(){
+		func() {
+			for n, input := range inputs {
+				oneOf("Forward", n, nn.Forward(input))
+			}
+		},
+		func() {
+			output := make([]float64, 4)
+			for n, input := range inputs {
+				nn.ForwardInto(output, input)
+				oneOf("ForwardInto", n, output)
+			}
+		},
+		func() {
+			for n, output := range nn.ForwardBatch(inputs) {
+				oneOf("ForwardBatch", n, output)
+			}
+		},
+		func() {
+			if w := nn.GetWeight2(11, 3); w != small.GetWeight2(11, 3) && w != large.GetWeight2(11, 3) {
+				t.Errorf("GetWeight2 = %v, want %v or %v", w, small.GetWeight2(11, 3), large.GetWeight2(11, 3))
+			}
+		},
+		func() {
+			path := filepath.Join(dir, "reader.json")
+			if err := nn.SaveWeights(path); err != nil {
+				t.Error(err)
+				return
+			}
+			saved := &NeuralNetwork{}
+			if err := saved.SetActivationFunction("relu-softmax"); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := saved.LoadWeights(path); err != nil {
+				t.Error(err)
+				return
+			}
+			for n, output := range saved.ForwardBatch(inputs) {
+				oneOf("saved weights", n, output)
+			}
+		},
+	}
+	runConcurrently(t, readers, func() {
+		for i := 0; i < 20; i++ {
+			if err := nn.LoadWeights(paths[i%2]); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+}
+
+// TestConcurrentNeuralNetworkResizeDuringFit loads weights of another hidden
+// size while Fit runs, which then trains the new layers.
+func TestConcurrentNeuralNetworkResizeDuringFit(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	inputs, outputs := classification(rng, 64, 8, 4)
+	nn := NewNeuralNetworkRand(8, 16, 4, "relu-softmax", rng)
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "small.json"), filepath.Join(dir, "large.json")}
+	for i, hidden := range []int{12, 16} {
+		if err := NewNeuralNetworkRand(8, hidden, 4, "relu-softmax", rng).SaveWeights(paths[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loads := 0
+	readers := []func(){
+		func() {
+			if err := nn.LoadWeights(paths[loads%2]); err != nil {
+				t.Error(err)
+			}
+			loads++
+		},
+		func() {
+			for _, input := range inputs {
+				if output := nn.Forward(input); len(output) != 4 {
+					t.Errorf("Forward returned %d values, want 4", len(output))
+				}
+			}
+		},
+	}
+	runConcurrently(t, readers, func() {
+		fit(t, nn.Sequential, inputs, outputs, 8, 2)
+	})
+}
+
+// nnReaders returns functions reading nn in every way that is safe for
+// concurrent use.
+func nnReaders(t *testing.T, nn *NeuralNetwork, inputs [][]float64, dir string) []func() {
+	readers := []func(){
+		func() {
+			for _, input := range inputs {
+				nn.Forward(input)
+			}
+		},
+		func() {
+			output := make([]float64, 4)
+			for _, input := range inputs {
+				nn.ForwardInto(output, input)
+			}
+		},
+		func() {
+			nn.ForwardBatch(inputs)
+		},
+		func() {
+			nn.GetWeight1(1, 2)
+			nn.GetWeight2(3, 1)
+		},
+		func() {
+			nn.Float32()
+		},
+		func() {
+			if _, err := Quantize(nn, inputs); err != nil {
+				t.Error(err)
+			}
+		},
+	}
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("reader%d", i))
+		readers = append(readers, func() {
+			if err := nn.SaveWeights(path + ".json"); err != nil {
+				t.Error(err)
+			}
+			if err := nn.SaveWeightsBinary(path + ".gob"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	return readers
+}
+
+func TestConcurrentSequential(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	inputs, outputs := classification(rng, 64, 8, 4)
+	s := NewSequential(
+		NewDenseRand(8, 16, mustActivation(t, "relu"), rng),
+		NewBatchNorm(16),
+		NewDropout(0.2, rng),
+		NewDenseRand(16, 4, mustActivation(t, "sigmoid"), rng),
+	)
+	saved := filepath.Join(t.TempDir(), "sequential.json")
+	if err := s.SaveWeights(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	readers := []func(){
+		func() {
+			for _, input := range inputs {
+				s.Forward(input)
+			}
+		},
+		func() {
+			output := make([]float64, 4)
+			for _, input := range inputs {
+				s.ForwardInto(output, input)
+			}
+		},
+		func() {
+			s.ForwardBatch(inputs)
+		},
+		func() {
+			s.Evaluate(inputs, outputs)
+		},
+	}
+	// 学習していないオプティマイザの状態は、複数のゴルーチンから同時に保存できる
+	optimizer := NewAdam(0.01)
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("optimizer%d.json", i))
+		readers = append(readers, func() {
+			if err := s.SaveOptimizerState(path, optimizer); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	runConcurrently(t, readers,
+		func() {
+			fit(t, s, inputs, outputs, 8, 2)
+		},
+		func() {
+			for i := 0; i < 10; i++ {
+				if err := s.LoadWeights(saved); err != nil {
+					t.Error(err)
+				}
+			}
+		},
+	)
+}
+
+func TestConcurrentNeuralNetwork32(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")}
+	input := []float32{1, -1, 0.5, 0, 2, -0.5, 0.25, 1}
+	var expected [][]float32
+	for _, path := range paths {
+		nn32 := NewNeuralNetworkRand(8, 16, 4, "relu-sigmoid", rng).Float32()
+		if err := nn32.SaveWeights(path); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, nn32.Forward(input))
+	}
+	nn32 := NewNeuralNetwork32(8, 16, 4, "relu-sigmoid")
+	if err := nn32.LoadWeights(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	readers := []func(){
+		func() {
+			if output := nn32.Forward(input); !reflect.DeepEqual(output, expected[0]) && !reflect.DeepEqual(output, expected[1]) {
+				t.Errorf("Forward = %v, want %v or %v", output, expected[0], expected[1])
+			}
+		},
+		func() {
+			if err := nn32.SaveWeightsBinary(filepath.Join(dir, "reader.gob")); err != nil {
+				t.Error(err)
+			}
+		},
+		func() {
+			nn32.Float64()
+		},
+	}
+	runConcurrently(t, readers, func() {
+		for i := 0; i < 20; i++ {
+			if err := nn32.LoadWeights(paths[i%2]); err != nil {
+				t.Error(err)
+			}
+			if err := nn32.SetActivationFunction("relu-sigmoid"); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+}
+
+func TestConcurrentQuantizedNetwork(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	inputs, _ := classification(rng, 16, 8, 4)
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.gob"), filepath.Join(dir, "b.gob")}
+	var expected [][][]float64
+	for _, path := range paths {
+		q, err := Quantize(NewNeuralNetworkRand(8, 16, 4, "relu-sigmoid", rng), inputs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.SaveWeightsBinary(path); err != nil {
+			t.Fatal(err)
+		}
+		outputs := make([][]float64, len(inputs))
+		for n, input := range inputs {
+			outputs[n] = q.Forward(input)
+		}
+		expected = append(expected, outputs)
+	}
+	q := &QuantizedNetwork{}
+	if err := q.LoadWeightsBinary(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	readers := []func(){
+		func() {
+			for n, input := range inputs {
+				if output := q.Forward(input); !reflect.DeepEqual(output, expected[0][n]) && !reflect.DeepEqual(output, expected[1][n]) {
+					t.Errorf("Forward of input %d = %v, want %v or %v", n, output, expected[0][n], expected[1][n])
+				}
+			}
+		},
+		func() {
+			if err := q.SaveWeightsBinary(filepath.Join(dir, "reader.gob")); err != nil {
+				t.Error(err)
+			}
+		},
+	}
+	runConcurrently(t, readers, func() {
+		for i := 0; i < 20; i++ {
+			if err := q.LoadWeightsBinary(paths[i%2]); err != nil {
+				t.Error(err)
+			}
+			if err := q.SetActivationFunction("relu-sigmoid"); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+}
+
+// runConcurrently runs every writer once, all at the same time, while every
+// reader is called in a loop from its own goroutine until the writers return.
+func runConcurrently(t *testing.T, readers []func(), writers ...func()) {
+	t.Helper()
+	done := make(chan struct{})
+	readersDone := sync.WaitGroup{}
+	for _, read := range readers {
+		readersDone.Add(1)
+		go func(read func()) {
+			defer readersDone.Done()
+			for {
+				read()
+				select {
+				case <-done:
+					return
+				default:
+				}
+			}
+		}(read)
+	}
+
+	writersDone := sync.WaitGroup{}
+	for _, write := range writers {
+		writersDone.Add(1)
+		go func(write func()) {
+			defer writersDone.Done()
+			write()
+		}(write)
+	}
+	writersDone.Wait()
+	close(done)
+	readersDone.Wait()
+}
+
+func fit(t *testing.T, s *Sequential, inputs, outputs [][]float64, batchSize, workers int) {
+	_, err := s.Fit(inputs, outputs, TrainConfig{
+		Epochs:             3,
+		Optimizer:          NewAdam(0.01),
+		BatchSize:          batchSize,
+		Shuffle:            true,
+		Rand:               rand.New(rand.NewSource(1)),
+		Workers:            workers,
+		ValidationSplit:    0.25,
+		RestoreBestWeights: true,
+		Logger:             NoLogger,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// classification returns n random inputs labeled with one of classes by the
+// part of the input holding its largest value.
+func equalWithin(a, b []float64, tolerance float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func classification(rng *rand.Rand, n, size, classes int) ([][]float64, [][]float64) {
+	inputs := randomInputs(rng, n, size)
+	outputs := make([][]float64, n)
+	for i, input := range inputs {
+		outputs[i] = make([]float64, classes)
+		outputs[i][argmax(input)*classes/size] = 1
+	}
+	return inputs, outputs
+}
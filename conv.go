@@ -0,0 +1,438 @@
+package gonn
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Shape describes image-like samples. Such samples are stored as flat slices
+// in channel, row, column order.
+type Shape struct {
+	Channels int
+	Height   int
+	Width    int
+}
+
+// Size returns the number of values in a sample of the shape.
+func (s Shape) Size() int {
+	return s.Channels * s.Height * s.Width
+}
+
+func (s Shape) index(c, y, x int) int {
+	return (c*s.Height+y)*s.Width + x
+}
+
+// Conv2DOptions configures a Conv2D layer. A zero Stride or Dilation means 1.
+type Conv2DOptions struct {
+	Stride   int
+	Padding  int
+	Dilation int
+}
+
+// Conv2D is a 2D convolution over samples of shape input with square kernels,
+// followed by an activation.
+type Conv2D struct {
+	input      Shape
+	output     Shape
+	kernel     int
+	stride     int
+	padding    int
+	dilation   int
+	activation Activation
+	// weights holds one row per filter with kernels in channel, row, column
+	// order.
+	weights, bias tensorParam
+
+	// columns holds the im2col matrix of every input: a row per output
+	// position with the input values its kernel covers.
+	columns        []*Tensor
+	preActivations [][]float64
+	outputs        [][]float64
+}
+
+// NewConv2D returns a convolution with the given number of filters and kernel
+// size, Xavier uniform weights and zero biases.
+func NewConv2D(input Shape, filters, kernel int, options Conv2DOptions, activation Activation) *Conv2D {
+	return NewConv2DRand(input, filters, kernel, options, activation, nil)
+}
+
+// NewConv2DRand is like NewConv2D but draws the initial weights from rng.
+// A nil rng uses a shared source seeded with the current time.
+func NewConv2DRand(input Shape, filters, kernel int, options Conv2DOptions, activation Activation, rng *rand.Rand) *Conv2D {
+	c := newConv2D(input, filters, kernel, options, activation)
+	return c.Initialize(XavierUniform, Zeros, rng)
+}
+
+func newConv2D(input Shape, filters, kernel int, options Conv2DOptions, activation Activation) *Conv2D {
+	c := &Conv2D{
+		input:      input,
+		kernel:     kernel,
+		stride:     options.Stride,
+		padding:    options.Padding,
+		dilation:   options.Dilation,
+		activation: activation,
+	}
+	if c.stride <= 0 {
+		c.stride = 1
+	}
+	if c.dilation <= 0 {
+		c.dilation = 1
+	}
+	span := c.dilation*(kernel-1) + 1
+	c.output = Shape{
+		Channels: filters,
+		Height:   (input.Height+2*c.padding-span)/c.stride + 1,
+		Width:    (input.Width+2*c.padding-span)/c.stride + 1,
+	}
+	size := input.Channels * kernel * kernel
+	c.weights = newTensorParam(filters, size)
+	c.bias = newTensorParam(1, filters)
+	return c
+}
+
+// Initialize re-initializes the weights and biases of the layer and returns
+// the layer. A nil weights initializer keeps the Xavier uniform default and a
+// nil bias initializer sets the biases to zero.
+func (c *Conv2D) Initialize(weights, bias Initializer, rng *rand.Rand) *Conv2D {
+	rng = randOrDefault(rng)
+	if weights == nil {
+		weights = XavierUniform
+	}
+	if bias == nil {
+		bias = Zeros
+	}
+	fanIn := c.input.Channels * c.kernel * c.kernel
+	fanOut := c.output.Channels * c.kernel * c.kernel
+	weights(c.weights.Value, fanIn, fanOut, rng)
+	bias(c.bias.Value, fanIn, fanOut, rng)
+	return c
+}
+
+// OutputShape returns the shape of the samples produced by the layer.
+func (c *Conv2D) OutputShape() Shape {
+	return c.output
+}
+
+// SetRegularization sets the strengths of the L1 and L2 penalties on the
+// weights of the layer. Biases are not penalized.
+func (c *Conv2D) SetRegularization(l1, l2 float64) *Conv2D {
+	c.weights.L1 = l1
+	c.weights.L2 = l2
+	return c
+}
+
+func (c *Conv2D) Replicate() Layer {
+	r := *c
+	r.weights = c.weights.share()
+	r.bias = c.bias.share()
+	r.columns, r.preActivations, r.outputs = nil, nil, nil
+	return &r
+}
+
+// visit calls f for every output position and every input value the kernel
+// covers there, with o the output index without the channel and w the index
+// into the kernel of a filter. Positions in the padding are skipped.
+func (c *Conv2D) visit(f func(o, i, w int)) {
+	for oy := 0; oy < c.output.Height; oy++ {
+		for ox := 0; ox < c.output.Width; ox++ {
+			o := oy*c.output.Width + ox
+			for ch := 0; ch < c.input.Channels; ch++ {
+				for ky := 0; ky < c.kernel; ky++ {
+					y := oy*c.stride - c.padding + ky*c.dilation
+					if y < 0 || y >= c.input.Height {
+						continue
+					}
+					for kx := 0; kx < c.kernel; kx++ {
+						x := ox*c.stride - c.padding + kx*c.dilation
+						if x < 0 || x >= c.input.Width {
+							continue
+						}
+						f(o, c.input.index(ch, y, x), (ch*c.kernel+ky)*c.kernel+kx)
+					}
+				}
+			}
+		}
+	}
+}
+
+// im2col returns the matrix with a row per output position holding the input
+// values the kernel covers there, so that the convolution becomes a matrix
+// product with the weights.
+func (c *Conv2D) im2col(input []float64) *Tensor {
+	size := c.weights.value.Shape[1]
+	columns := NewTensor(c.output.Height*c.output.Width, size)
+	c.visit(func(o, i, w int) {
+		columns.Data[o*size+w] = input[i]
+	})
+	return columns
+}
+
+func (c *Conv2D) Forward(inputs [][]float64) [][]float64 {
+	columns, preActivations, outputs := c.forward(inputs)
+	c.columns = columns
+	c.preActivations = preActivations
+	c.outputs = outputs
+	return outputs
+}
+
+func (c *Conv2D) Predict(inputs [][]float64) [][]float64 {
+	_, _, outputs := c.forward(inputs)
+	return outputs
+}
+
+func (c *Conv2D) forward(inputs [][]float64) ([]*Tensor, [][]float64, [][]float64) {
+	columns := make([]*Tensor, len(inputs))
+	preActivations := make([][]float64, len(inputs))
+	outputs := make([][]float64, len(inputs))
+	for n, input := range inputs {
+		columns[n] = c.im2col(input)
+		// フィルタごとの行に並べるため重みを左から掛ける
+		z := MatMul(c.weights.value, columns[n].Transpose())
+		z.AddInPlace(c.bias.value.Transpose())
+		preActivations[n] = z.Data
+		outputs[n] = c.activation.Apply(z.Data)
+	}
+	return columns, preActivations, outputs
+}
+
+func (c *Conv2D) Backward(grads [][]float64) [][]float64 {
+	plane := c.output.Height * c.output.Width
+	size := c.weights.value.Shape[1]
+	inputGrads := make([][]float64, len(grads))
+	for n, grad := range grads {
+		delta := TensorFrom(c.activation.Backward(c.preActivations[n], c.outputs[n], grad), c.output.Channels, plane)
+		matMulAdd(c.weights.grad, delta, c.columns[n])
+		c.bias.grad.AddInPlace(delta.Sum(1).Transpose())
+
+		columnGrads := MatMul(delta.Transpose(), c.weights.value)
+		inputGrad := make([]float64, c.input.Size())
+		c.visit(func(o, i, w int) {
+			inputGrad[i] += columnGrads.Data[o*size+w]
+		})
+		inputGrads[n] = inputGrad
+	}
+	return inputGrads
+}
+
+func (c *Conv2D) Params() []*Param {
+	return []*Param{c.weights.Param, c.bias.Param}
+}
+
+// pool2D is shared by MaxPool2D and AvgPool2D.
+type pool2D struct {
+	input  Shape
+	output Shape
+	size   int
+	stride int
+	// windows holds the input indices of the window of every output value,
+	// one window after another.
+	windows []int
+}
+
+func newPool2D(input Shape, size, stride int) pool2D {
+	if stride <= 0 {
+		stride = size
+	}
+	p := pool2D{
+		input: input,
+		output: Shape{
+			Channels: input.Channels,
+			Height:   (input.Height-size)/stride + 1,
+			Width:    (input.Width-size)/stride + 1,
+		},
+		size:   size,
+		stride: stride,
+	}
+	p.windows = make([]int, 0, p.output.Size()*size*size)
+	for ch := 0; ch < p.output.Channels; ch++ {
+		for oy := 0; oy < p.output.Height; oy++ {
+			for ox := 0; ox < p.output.Width; ox++ {
+				for ky := 0; ky < size; ky++ {
+					for kx := 0; kx < size; kx++ {
+						p.windows = append(p.windows, input.index(ch, oy*stride+ky, ox*stride+kx))
+					}
+				}
+			}
+		}
+	}
+	return p
+}
+
+// OutputShape returns the shape of the samples produced by the layer.
+func (p pool2D) OutputShape() Shape {
+	return p.output
+}
+
+// im2col returns the matrix with a row per output value of every sample
+// holding the inputs of its window, so that pooling becomes a reduction over
+// the rows.
+func (p pool2D) im2col(x *Tensor) *Tensor {
+	samples, in, window := x.Shape[0], p.input.Size(), len(p.windows)
+	columns := NewTensor(samples*p.output.Size(), p.size*p.size)
+	for n := 0; n < samples; n++ {
+		for r, i := range p.windows {
+			columns.Data[n*window+r] = x.Data[n*in+i]
+		}
+	}
+	return columns
+}
+
+// col2im sums the gradients of the rows of columns into the inputs of their
+// windows.
+func (p pool2D) col2im(columns *Tensor) [][]float64 {
+	window := len(p.windows)
+	samples, in := len(columns.Data)/window, p.input.Size()
+	grads := NewTensor(samples, in)
+	for n := 0; n < samples; n++ {
+		for r, i := range p.windows {
+			grads.Data[n*in+i] += columns.Data[n*window+r]
+		}
+	}
+	return grads.Rows()
+}
+
+func (p pool2D) Params() []*Param {
+	return nil
+}
+
+// MaxPool2D takes the maximum of every size x size window of each channel.
+type MaxPool2D struct {
+	pool2D
+	argmax []int
+}
+
+// NewMaxPool2D returns a max pooling layer. A zero stride means size.
+func NewMaxPool2D(input Shape, size, stride int) *MaxPool2D {
+	return &MaxPool2D{pool2D: newPool2D(input, size, stride)}
+}
+
+func (m *MaxPool2D) Forward(inputs [][]float64) [][]float64 {
+	columns := m.im2col(batchTensor(inputs, m.input.Size()))
+	m.argmax = columns.argmaxRows()
+	return columns.Max(1).Reshape(len(inputs), m.output.Size()).Rows()
+}
+
+func (m *MaxPool2D) Predict(inputs [][]float64) [][]float64 {
+	columns := m.im2col(batchTensor(inputs, m.input.Size()))
+	return columns.Max(1).Reshape(len(inputs), m.output.Size()).Rows()
+}
+
+func (m *MaxPool2D) Backward(grads [][]float64) [][]float64 {
+	g := batchTensor(grads, m.output.Size())
+	columns := NewTensor(len(m.argmax), m.size*m.size)
+	for r, j := range m.argmax {
+		columns.Data[r*columns.Shape[1]+j] = g.Data[r]
+	}
+	return m.col2im(columns)
+}
+
+func (m *MaxPool2D) Replicate() Layer {
+	return &MaxPool2D{pool2D: m.pool2D}
+}
+
+// AvgPool2D takes the mean of every size x size window of each channel.
+type AvgPool2D struct {
+	pool2D
+}
+
+// NewAvgPool2D returns an average pooling layer. A zero stride means size.
+func NewAvgPool2D(input Shape, size, stride int) *AvgPool2D {
+	return &AvgPool2D{pool2D: newPool2D(input, size, stride)}
+}
+
+func (a *AvgPool2D) Forward(inputs [][]float64) [][]float64 {
+	columns := a.im2col(batchTensor(inputs, a.input.Size()))
+	return columns.Mean(1).Reshape(len(inputs), a.output.Size()).Rows()
+}
+
+func (a *AvgPool2D) Predict(inputs [][]float64) [][]float64 {
+	return a.Forward(inputs)
+}
+
+func (a *AvgPool2D) Backward(grads [][]float64) [][]float64 {
+	// 出力の勾配を窓の各要素に均等に配る
+	g := batchTensor(grads, a.output.Size()).Reshape(len(grads)*a.output.Size(), 1)
+	window := a.size * a.size
+	columns := Add(NewTensor(g.Shape[0], window), g).Scale(1 / float64(window))
+	return a.col2im(columns)
+}
+
+func (a *AvgPool2D) Replicate() Layer {
+	return &AvgPool2D{pool2D: a.pool2D}
+}
+
+// GlobalAvgPool averages every channel of its input to a single value.
+type GlobalAvgPool struct {
+	input Shape
+}
+
+// NewGlobalAvgPool returns a layer producing one value per channel of input.
+func NewGlobalAvgPool(input Shape) *GlobalAvgPool {
+	return &GlobalAvgPool{input: input}
+}
+
+func (g *GlobalAvgPool) Forward(inputs [][]float64) [][]float64 {
+	plane := g.input.Height * g.input.Width
+	x := batchTensor(inputs, g.input.Size()).Reshape(len(inputs), g.input.Channels, plane)
+	return x.Mean(2).Reshape(len(inputs), g.input.Channels).Rows()
+}
+
+func (g *GlobalAvgPool) Predict(inputs [][]float64) [][]float64 {
+	return g.Forward(inputs)
+}
+
+func (g *GlobalAvgPool) Backward(grads [][]float64) [][]float64 {
+	plane := g.input.Height * g.input.Width
+	d := batchTensor(grads, g.input.Channels).Reshape(len(grads), g.input.Channels, 1)
+	inputGrads := Add(NewTensor(len(grads), g.input.Channels, plane), d).Scale(1 / float64(plane))
+	return inputGrads.Reshape(len(grads), g.input.Size()).Rows()
+}
+
+func (g *GlobalAvgPool) Params() []*Param {
+	return nil
+}
+
+func (g *GlobalAvgPool) Replicate() Layer {
+	return g
+}
+
+// Flatten passes image-like samples on to dense layers. Samples are already
+// stored flat, so it only checks that every sample has the size of input.
+type Flatten struct {
+	input Shape
+}
+
+// NewFlatten returns a layer flattening samples of shape input.
+func NewFlatten(input Shape) *Flatten {
+	return &Flatten{input: input}
+}
+
+// OutputSize returns the number of values in a flattened sample.
+func (f *Flatten) OutputSize() int {
+	return f.input.Size()
+}
+
+func (f *Flatten) Forward(inputs [][]float64) [][]float64 {
+	for _, input := range inputs {
+		if len(input) != f.input.Size() {
+			panic(fmt.Sprintf("flatten: got a sample of %d values, want %d", len(input), f.input.Size()))
+		}
+	}
+	return inputs
+}
+
+func (f *Flatten) Predict(inputs [][]float64) [][]float64 {
+	return f.Forward(inputs)
+}
+
+func (f *Flatten) Backward(grads [][]float64) [][]float64 {
+	return grads
+}
+
+func (f *Flatten) Params() []*Param {
+	return nil
+}
+
+func (f *Flatten) Replicate() Layer {
+	return f
+}
@@ -0,0 +1,54 @@
+package gonn
+
+import (
+	"math/rand"
+)
+
+// Dropout zeroes every input with probability Rate during training and scales
+// the remaining ones by 1/(1-Rate). It passes inputs through unchanged at
+// inference time.
+type Dropout struct {
+	Rate    float64
+	rng     *rand.Rand
+	mask    *Tensor
+	lengths []int
+}
+
+// NewDropout returns a dropout layer drawing its masks from rng. A nil rng uses
+// a shared source seeded with the current time.
+func NewDropout(rate float64, rng *rand.Rand) *Dropout {
+	return &Dropout{Rate: rate, rng: randOrDefault(rng)}
+}
+
+func (d *Dropout) Forward(inputs [][]float64) [][]float64 {
+	// 系列など長さの異なるサンプルも扱えるよう、バッチを1次元に並べてマスクを掛ける
+	x, lengths := flatBatch(inputs)
+	scale := 1 / (1 - d.Rate)
+	d.mask = NewTensor(x.Shape...)
+	for i := range d.mask.Data {
+		if d.rng.Float64() >= d.Rate {
+			d.mask.Data[i] = scale
+		}
+	}
+	d.lengths = lengths
+	return splitBatch(Mul(x, d.mask), lengths)
+}
+
+func (d *Dropout) Predict(inputs [][]float64) [][]float64 {
+	return inputs
+}
+
+func (d *Dropout) Backward(grads [][]float64) [][]float64 {
+	g, _ := flatBatch(grads)
+	return splitBatch(Mul(g, d.mask), d.lengths)
+}
+
+func (d *Dropout) Params() []*Param {
+	return nil
+}
+
+// Replicate returns a dropout layer with its own source seeded from the source
+// of d, so that data-parallel runs stay reproducible.
+func (d *Dropout) Replicate() Layer {
+	return NewDropout(d.Rate, rand.New(rand.NewSource(d.rng.Int63())))
+}
@@ -0,0 +1,132 @@
+package gonn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Embedding maps integer IDs to trainable vectors. Every input value is an ID
+// between 0 and the vocabulary size; a sample of n IDs becomes the n vectors
+// one after another, the sequence layout used by the recurrent and attention
+// layers. Only the vectors of the IDs in a batch receive gradients, and
+// optimizers update only those rows.
+type Embedding struct {
+	vectors tensorParam
+	ids     [][]int
+}
+
+// NewEmbedding returns an embedding of vocabSize IDs into vectors of size
+// values initialized with Xavier uniform.
+func NewEmbedding(vocabSize, size int) *Embedding {
+	return NewEmbeddingRand(vocabSize, size, nil)
+}
+
+// NewEmbeddingRand is like NewEmbedding but draws the initial vectors from rng.
+// A nil rng uses a shared source seeded with the current time.
+func NewEmbeddingRand(vocabSize, size int, rng *rand.Rand) *Embedding {
+	e := &Embedding{vectors: newTensorParam(vocabSize, size)}
+	e.vectors.Sparse = true
+	XavierUniform(e.vectors.Value, 1, size, randOrDefault(rng))
+	return e
+}
+
+// SetVectors replaces the vectors with pre-trained ones, one row per ID.
+func (e *Embedding) SetVectors(vectors [][]float64) error {
+	if !sameShape(vectors, e.vectors.Value) {
+		return fmt.Errorf("got %d vectors, want %d vectors of %d values", len(vectors), len(e.vectors.Value), len(e.vectors.Value[0]))
+	}
+	for i := range vectors {
+		copy(e.vectors.Value[i], vectors[i])
+	}
+	return nil
+}
+
+// ReadVectors reads pre-trained vectors in the text format of GloVe and
+// word2vec, one token followed by its values per line, and returns the tokens
+// and their vectors. The ID of a token is its line number. A word2vec header
+// line holding only the counts is skipped.
+func ReadVectors(r io.Reader) ([]string, [][]float64, error) {
+	tokens := []string{}
+	vectors := [][]float64{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || (line == 1 && len(fields) == 2) {
+			continue
+		}
+		vector := make([]float64, len(fields)-1)
+		for i, f := range fields[1:] {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			vector[i] = v
+		}
+		if len(vectors) > 0 && len(vector) != len(vectors[0]) {
+			return nil, nil, fmt.Errorf("line %d: got %d values, want %d", line, len(vector), len(vectors[0]))
+		}
+		tokens = append(tokens, fields[0])
+		vectors = append(vectors, vector)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return tokens, vectors, nil
+}
+
+func (e *Embedding) Forward(inputs [][]float64) [][]float64 {
+	outputs, ids := e.forward(inputs)
+	e.ids = ids
+	return outputs
+}
+
+func (e *Embedding) Predict(inputs [][]float64) [][]float64 {
+	outputs, _ := e.forward(inputs)
+	return outputs
+}
+
+func (e *Embedding) forward(inputs [][]float64) ([][]float64, [][]int) {
+	outputs := make([][]float64, len(inputs))
+	ids := make([][]int, len(inputs))
+	for n, input := range inputs {
+		ids[n] = make([]int, len(input))
+		output := make([]float64, 0, len(input)*len(e.vectors.Value[0]))
+		for i, x := range input {
+			id := int(x)
+			if id < 0 || id >= len(e.vectors.Value) {
+				panic(fmt.Sprintf("embedding: ID %v is out of range [0, %d)", x, len(e.vectors.Value)))
+			}
+			ids[n][i] = id
+			output = append(output, e.vectors.Value[id]...)
+		}
+		outputs[n] = output
+	}
+	return outputs, ids
+}
+
+// Backward accumulates the gradients of the looked up vectors. IDs are not
+// differentiable, so the returned gradients are zero.
+func (e *Embedding) Backward(grads [][]float64) [][]float64 {
+	size := len(e.vectors.Value[0])
+	inputGrads := make([][]float64, len(grads))
+	for n, grad := range grads {
+		for i, id := range e.ids[n] {
+			addTo(e.vectors.Grad[id], grad[i*size:(i+1)*size])
+		}
+		inputGrads[n] = make([]float64, len(e.ids[n]))
+	}
+	return inputGrads
+}
+
+func (e *Embedding) Params() []*Param {
+	return []*Param{e.vectors.Param}
+}
+
+func (e *Embedding) Replicate() Layer {
+	return &Embedding{vectors: e.vectors.share()}
+}
@@ -2,4 +2,4 @@ module github.com/takoyaki-3/go-nn/v2
 
 go 1.15
 
-require github.com/takoyaki-3/go-json v0.0.2 // indirect
+require github.com/takoyaki-3/go-json v0.0.2
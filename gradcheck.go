@@ -0,0 +1,75 @@
+package gonn
+
+import (
+	"math"
+)
+
+// gradCheckStep is the step used for the central finite differences.
+const gradCheckStep = 1e-5
+
+// GradCheck compares the gradients computed by backpropagation with central
+// finite differences of the model's loss over inputs and targets, and returns
+// the largest difference found. Differences are relative to the magnitude of
+// the gradients when it exceeds 1 and absolute otherwise, so a correct model
+// typically returns a value below 1e-6.
+//
+// The loss includes the L1 and L2 penalties of the parameters, as in Fit. The
+// forward passes run in training mode, so layers such as Dropout must be
+// deterministic; the buffers of the model, such as the running statistics of
+// BatchNorm, are restored afterwards. The accumulated gradients of the model
+// are reset.
+func GradCheck(model *Sequential, inputs, targets [][]float64) float64 {
+	l := model.LossFunction()
+	params := model.Params()
+	buffers := model.Buffers()
+	saved := make([][][]float64, len(buffers))
+	for i, b := range buffers {
+		saved[i] = zerosLike(b)
+		for j := range b {
+			copy(saved[i][j], b[j])
+		}
+	}
+	defer func() {
+		for i, b := range buffers {
+			for j := range b {
+				copy(b[j], saved[i][j])
+			}
+		}
+	}()
+
+	model.ZeroGrad()
+	model.backwardLoss(l, model.forward(inputs), targets, 1)
+	penalty(params)
+
+	lossAt := func() float64 {
+		total := penaltyValue(params)
+		for n, output := range model.forward(inputs) {
+			total += l.Value(output, targets[n])
+		}
+		return total
+	}
+
+	worst := 0.0
+	for _, p := range params {
+		for i := range p.Value {
+			for j := range p.Value[i] {
+				original := p.Value[i][j]
+				p.Value[i][j] = original + gradCheckStep
+				plus := lossAt()
+				p.Value[i][j] = original - gradCheckStep
+				minus := lossAt()
+				p.Value[i][j] = original
+
+				numeric := (plus - minus) / (2 * gradCheckStep)
+				analytic := p.Grad[i][j]
+				diff := math.Abs(analytic-numeric) / math.Max(1, math.Abs(analytic)+math.Abs(numeric))
+				if diff > worst {
+					worst = diff
+				}
+			}
+		}
+	}
+
+	model.ZeroGrad()
+	return worst
+}
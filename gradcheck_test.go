@@ -0,0 +1,335 @@
+package gonn
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// gradCheckTolerance is the largest difference GradCheck may report for a
+// correct model.
+const gradCheckTolerance = 1e-6
+
+func TestGradCheckActivations(t *testing.T) {
+	activationsMu.RLock()
+	names := make([]string, 0, len(activations))
+	for name := range activations {
+		names = append(names, name)
+	}
+	activationsMu.RUnlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			a := mustActivation(t, name)
+			model := NewSequential(
+				NewDenseRand(3, 4, a, rng),
+				NewDenseRand(4, 3, a, rng),
+			)
+			inputs := randomInputs(rng, 4, 3)
+			checkGradients(t, model, inputs, randomTargets(rng, model, inputs))
+		})
+	}
+}
+
+func TestGradCheckFusedLosses(t *testing.T) {
+	for _, c := range []struct {
+		activation string
+		loss       string
+	}{
+		{"softmax", "cross-entropy"},
+		{"sigmoid", "binary-cross-entropy"},
+	} {
+		t.Run(c.loss, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			model := NewSequential(
+				NewDenseRand(3, 4, mustActivation(t, "tanh"), rng),
+				NewDenseRand(4, 3, mustActivation(t, c.activation), rng),
+			)
+			if err := model.SetLoss(c.loss); err != nil {
+				t.Fatal(err)
+			}
+			// y - t の勾配は和が 1 の目標値を前提とするので one-hot を使う
+			inputs := randomInputs(rng, 4, 3)
+			targets := make([][]float64, len(inputs))
+			for n := range targets {
+				targets[n] = make([]float64, 3)
+				targets[n][rng.Intn(3)] = 1
+			}
+			checkGradients(t, model, inputs, targets)
+		})
+	}
+}
+
+func TestGradCheckLayers(t *testing.T) {
+	image := Shape{Channels: 2, Height: 4, Width: 4}
+	for _, c := range []struct {
+		name   string
+		model  func(t *testing.T, rng *rand.Rand) *Sequential
+		inputs func(rng *rand.Rand) [][]float64
+	}{
+		{
+			name: "Dense",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewDenseRand(3, 4, mustActivation(t, "tanh"), rng),
+					NewDenseRand(4, 2, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+			inputs: vectors(4, 3),
+		},
+		{
+			name: "Regularization",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewDenseRand(3, 4, mustActivation(t, "tanh"), rng).SetRegularization(0.5, 0),
+					NewDenseRand(4, 2, mustActivation(t, "sigmoid"), rng).SetRegularization(0, 0.5),
+				)
+			},
+			inputs: vectors(4, 3),
+		},
+		{
+			// 勾配の確認には決まったマスクが必要なので、割合 0 で素通しの経路を確かめる
+			name: "Dropout",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewDenseRand(3, 4, mustActivation(t, "tanh"), rng),
+					NewDropout(0, rng),
+					NewDenseRand(4, 2, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+			inputs: vectors(4, 3),
+		},
+		{
+			name: "BatchNorm",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewDenseRand(3, 4, mustActivation(t, "linear"), rng),
+					NewBatchNorm(4),
+					NewDenseRand(4, 2, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+			inputs: vectors(4, 3),
+		},
+		{
+			name: "LayerNorm",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewDenseRand(3, 4, mustActivation(t, "linear"), rng),
+					NewLayerNorm(4),
+					NewDenseRand(4, 2, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+			inputs: vectors(4, 3),
+		},
+		{
+			name: "Conv2D",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				conv := NewConv2DRand(image, 3, 3, Conv2DOptions{Stride: 2, Padding: 1}, mustActivation(t, "tanh"), rng)
+				return NewSequential(
+					conv,
+					NewFlatten(conv.OutputShape()),
+					NewDenseRand(conv.OutputShape().Size(), 2, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+			inputs: vectors(2, image.Size()),
+		},
+		{
+			name: "MaxPool2D",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				conv := NewConv2DRand(image, 2, 3, Conv2DOptions{Padding: 1}, mustActivation(t, "tanh"), rng)
+				pool := NewMaxPool2D(conv.OutputShape(), 2, 2)
+				return NewSequential(conv, pool, NewDenseRand(pool.OutputShape().Size(), 2, mustActivation(t, "sigmoid"), rng))
+			},
+			inputs: vectors(2, image.Size()),
+		},
+		{
+			name: "AvgPool2D",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				conv := NewConv2DRand(image, 2, 3, Conv2DOptions{Padding: 1}, mustActivation(t, "tanh"), rng)
+				pool := NewAvgPool2D(conv.OutputShape(), 3, 1)
+				return NewSequential(conv, pool, NewDenseRand(pool.OutputShape().Size(), 2, mustActivation(t, "sigmoid"), rng))
+			},
+			inputs: vectors(2, image.Size()),
+		},
+		{
+			name: "GlobalAvgPool",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				conv := NewConv2DRand(image, 3, 3, Conv2DOptions{Padding: 1}, mustActivation(t, "tanh"), rng)
+				return NewSequential(conv, NewGlobalAvgPool(conv.OutputShape()), NewDenseRand(3, 2, mustActivation(t, "sigmoid"), rng))
+			},
+			inputs: vectors(2, image.Size()),
+		},
+		{
+			name: "SimpleRNN",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewSimpleRNNRand(3, 4, RecurrentOptions{}, rng),
+					NewDenseRand(4, 2, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+			inputs: sequences(3, 2, 4, 3),
+		},
+		{
+			name: "LSTM",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewLSTMRand(3, 4, RecurrentOptions{}, rng),
+					NewDenseRand(4, 2, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+			inputs: sequences(3, 2, 4, 3),
+		},
+		{
+			name: "GRU",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewGRURand(3, 4, RecurrentOptions{}, rng),
+					NewDenseRand(4, 2, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+			inputs: sequences(3, 2, 4, 3),
+		},
+		{
+			name: "LSTMSequences",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewLSTMRand(3, 4, RecurrentOptions{ReturnSequences: true}, rng),
+					NewTimeDistributed(NewDenseRand(4, 2, mustActivation(t, "sigmoid"), rng), 4),
+				)
+			},
+			inputs: sequences(3, 2, 4, 3),
+		},
+		{
+			name: "MultiHeadAttention",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewPositionalEncoding(4),
+					NewMultiHeadAttentionRand(4, 2, CausalMask, rng),
+					NewTimeDistributed(NewDenseRand(4, 1, mustActivation(t, "sigmoid"), rng), 4),
+				)
+			},
+			inputs: sequences(4, 3, 3, 2),
+		},
+		{
+			name: "TransformerEncoder",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewTransformerEncoderRand(4, 2, 6, nil, rng),
+					NewTimeDistributed(NewDenseRand(4, 1, mustActivation(t, "sigmoid"), rng), 4),
+				)
+			},
+			inputs: sequences(4, 3, 3, 2),
+		},
+		{
+			name: "Embedding",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewEmbeddingRand(5, 3, rng),
+					NewDenseRand(6, 2, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+			inputs: func(rng *rand.Rand) [][]float64 {
+				return [][]float64{{0, 3}, {4, 4}, {1, 0}}
+			},
+		},
+		{
+			name: "RegularizedEmbedding",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				embedding := NewEmbeddingRand(5, 3, rng)
+				embedding.Params()[0].L1 = 0.5
+				embedding.Params()[0].L2 = 0.5
+				return NewSequential(
+					embedding,
+					NewDenseRand(6, 2, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+			inputs: func(rng *rand.Rand) [][]float64 {
+				return [][]float64{{0, 3}, {4, 4}, {1, 0}}
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			model, inputs := c.model(t, rng), c.inputs(rng)
+			checkGradients(t, model, inputs, randomTargets(rng, model, inputs))
+		})
+	}
+}
+
+func TestGradCheckRestoresBuffers(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	model := NewSequential(
+		NewDenseRand(3, 4, mustActivation(t, "linear"), rng),
+		NewBatchNorm(4),
+	)
+	inputs := randomInputs(rng, 4, 3)
+	before := model.copyParams(nil)
+	checkGradients(t, model, inputs, randomTargets(rng, model, inputs))
+	if !reflect.DeepEqual(model.copyParams(nil), before) {
+		t.Error("GradCheck changed the parameters or the running statistics")
+	}
+}
+
+// checkGradients fails t when GradCheck finds a difference above the
+// tolerance.
+func checkGradients(t *testing.T, model *Sequential, inputs, targets [][]float64) {
+	t.Helper()
+	if diff := GradCheck(model, inputs, targets); diff > gradCheckTolerance {
+		t.Errorf("GradCheck = %g, want at most %g", diff, gradCheckTolerance)
+	}
+}
+
+// randomTargets returns targets in [0, 1) of the size of the outputs of model.
+func randomTargets(rng *rand.Rand, model *Sequential, inputs [][]float64) [][]float64 {
+	targets := make([][]float64, len(inputs))
+	for n, output := range model.ForwardBatch(inputs) {
+		targets[n] = make([]float64, len(output))
+		for i := range targets[n] {
+			targets[n][i] = rng.Float64()
+		}
+	}
+	return targets
+}
+
+func mustActivation(t *testing.T, name string) Activation {
+	t.Helper()
+	a, err := GetActivation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func randomInputs(rng *rand.Rand, n, size int) [][]float64 {
+	inputs := make([][]float64, n)
+	for i := range inputs {
+		inputs[i] = make([]float64, size)
+		for j := range inputs[i] {
+			inputs[i][j] = rng.NormFloat64()
+		}
+	}
+	return inputs
+}
+
+// vectors returns a generator of n random inputs of the given size.
+func vectors(n, size int) func(rng *rand.Rand) [][]float64 {
+	return func(rng *rand.Rand) [][]float64 {
+		return randomInputs(rng, n, size)
+	}
+}
+
+// sequences returns a generator of n random sequences of steps of the given
+// size, with lengths from minSteps to maxSteps.
+func sequences(size, minSteps, maxSteps, n int) func(rng *rand.Rand) [][]float64 {
+	return func(rng *rand.Rand) [][]float64 {
+		inputs := make([][]float64, n)
+		for i := range inputs {
+			steps := minSteps + i%(maxSteps-minSteps+1)
+			inputs[i] = randomInputs(rng, 1, steps*size)[0]
+		}
+		return inputs
+	}
+}
@@ -0,0 +1,157 @@
+package gonn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// Initializer fills values, a parameter of a layer with fanIn inputs and
+// fanOut outputs, with initial values drawn from rng. A nil rng uses a shared
+// source seeded with the current time.
+type Initializer func(values [][]float64, fanIn, fanOut int, rng *rand.Rand)
+
+// Zeros sets every value to 0.
+func Zeros(values [][]float64, fanIn, fanOut int, rng *rand.Rand) {
+	Constant(0)(values, fanIn, fanOut, rng)
+}
+
+// Constant returns an initializer setting every value to v.
+func Constant(v float64) Initializer {
+	return func(values [][]float64, fanIn, fanOut int, rng *rand.Rand) {
+		for i := range values {
+			for j := range values[i] {
+				values[i][j] = v
+			}
+		}
+	}
+}
+
+func uniform(values [][]float64, limit float64, rng *rand.Rand) {
+	rng = randOrDefault(rng)
+	for i := range values {
+		for j := range values[i] {
+			values[i][j] = (rng.Float64()*2 - 1) * limit
+		}
+	}
+}
+
+func normal(values [][]float64, stddev float64, rng *rand.Rand) {
+	rng = randOrDefault(rng)
+	for i := range values {
+		for j := range values[i] {
+			values[i][j] = rng.NormFloat64() * stddev
+		}
+	}
+}
+
+// XavierUniform (Glorot uniform) draws from U(-l, l) with
+// l = sqrt(6 / (fanIn + fanOut)). It suits sigmoid and tanh layers.
+func XavierUniform(values [][]float64, fanIn, fanOut int, rng *rand.Rand) {
+	uniform(values, math.Sqrt(6/float64(fanIn+fanOut)), rng)
+}
+
+// XavierNormal (Glorot normal) draws from N(0, 2 / (fanIn + fanOut)).
+func XavierNormal(values [][]float64, fanIn, fanOut int, rng *rand.Rand) {
+	normal(values, math.Sqrt(2/float64(fanIn+fanOut)), rng)
+}
+
+// HeUniform draws from U(-l, l) with l = sqrt(6 / fanIn). It suits ReLU
+// layers.
+func HeUniform(values [][]float64, fanIn, fanOut int, rng *rand.Rand) {
+	uniform(values, math.Sqrt(6/float64(fanIn)), rng)
+}
+
+// HeNormal draws from N(0, 2 / fanIn).
+func HeNormal(values [][]float64, fanIn, fanOut int, rng *rand.Rand) {
+	normal(values, math.Sqrt(2/float64(fanIn)), rng)
+}
+
+// LeCunUniform draws from U(-l, l) with l = sqrt(3 / fanIn). It suits SELU
+// and other self-normalizing layers.
+func LeCunUniform(values [][]float64, fanIn, fanOut int, rng *rand.Rand) {
+	uniform(values, math.Sqrt(3/float64(fanIn)), rng)
+}
+
+// LeCunNormal draws from N(0, 1 / fanIn).
+func LeCunNormal(values [][]float64, fanIn, fanOut int, rng *rand.Rand) {
+	normal(values, math.Sqrt(1/float64(fanIn)), rng)
+}
+
+// Orthogonal fills values with a random matrix whose rows, or columns when
+// there are more rows than columns, are orthonormal.
+func Orthogonal(values [][]float64, fanIn, fanOut int, rng *rand.Rand) {
+	normal(values, 1, rng)
+	rows := len(values)
+	if rows == 0 {
+		return
+	}
+	cols := len(values[0])
+
+	// 行数が列数以上なら列を、そうでなければ行を修正グラム・シュミット法で直交化する
+	vectors := rows
+	length := cols
+	at := func(v, k int) *float64 { return &values[v][k] }
+	if rows >= cols {
+		vectors, length = cols, rows
+		at = func(v, k int) *float64 { return &values[k][v] }
+	}
+	for v := 0; v < vectors; v++ {
+		for u := 0; u < v; u++ {
+			dot := 0.0
+			for k := 0; k < length; k++ {
+				dot += *at(v, k) * *at(u, k)
+			}
+			for k := 0; k < length; k++ {
+				*at(v, k) -= dot * *at(u, k)
+			}
+		}
+		norm := 0.0
+		for k := 0; k < length; k++ {
+			norm += *at(v, k) * *at(v, k)
+		}
+		norm = math.Sqrt(norm)
+		if norm == 0 {
+			continue
+		}
+		for k := 0; k < length; k++ {
+			*at(v, k) /= norm
+		}
+	}
+}
+
+var (
+	initializersMu sync.RWMutex
+	initializers   = map[string]Initializer{
+		"zeros":          Zeros,
+		"xavier_uniform": XavierUniform,
+		"xavier_normal":  XavierNormal,
+		"glorot_uniform": XavierUniform,
+		"glorot_normal":  XavierNormal,
+		"he_uniform":     HeUniform,
+		"he_normal":      HeNormal,
+		"lecun_uniform":  LeCunUniform,
+		"lecun_normal":   LeCunNormal,
+		"orthogonal":     Orthogonal,
+	}
+)
+
+// RegisterInitializer makes a user-defined initializer available under name,
+// replacing any initializer previously registered with that name.
+func RegisterInitializer(name string, init Initializer) {
+	initializersMu.Lock()
+	defer initializersMu.Unlock()
+	initializers[name] = init
+}
+
+// GetInitializer returns the initializer registered under name.
+func GetInitializer(name string) (Initializer, error) {
+	initializersMu.RLock()
+	defer initializersMu.RUnlock()
+	init, ok := initializers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown initializer: %q", name)
+	}
+	return init, nil
+}
@@ -0,0 +1,288 @@
+package gonn
+
+import (
+	"math/rand"
+)
+
+// Param is a trainable parameter of a layer together with the gradient
+// accumulated for it during backpropagation. Layers return the same Params on
+// every call so that optimizers can keep state for them.
+type Param struct {
+	Value [][]float64
+	Grad  [][]float64
+	// L1 and L2 are the strengths of the L1 and L2 penalties Fit adds to
+	// the loss for this parameter. For a sparse parameter, only the rows
+	// receiving a gradient in a step are penalized.
+	L1 float64
+	L2 float64
+	// Sparse marks parameters of which only a few rows receive gradients in
+	// every step, such as embeddings. Optimizers only update the rows with a
+	// non-zero gradient and leave the values and state of other rows alone.
+	Sparse bool
+}
+
+// rows returns the indices of the rows of p an optimizer step updates.
+func (p *Param) rows() []int {
+	rows := make([]int, 0, len(p.Value))
+	for i, grad := range p.Grad {
+		if p.Sparse && isZero(grad) {
+			continue
+		}
+		rows = append(rows, i)
+	}
+	return rows
+}
+
+func isZero(values []float64) bool {
+	for _, v := range values {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Layer is a single stage of a Sequential model.
+//
+// Forward receives a batch of inputs (one row per sample) and returns the
+// corresponding outputs. Backward receives the gradient of the loss with
+// respect to the outputs of the last Forward call, accumulates the gradients
+// of the layer's parameters and returns the gradient with respect to its
+// inputs.
+type Layer interface {
+	Forward(inputs [][]float64) [][]float64
+	Backward(grads [][]float64) [][]float64
+	Params() []*Param
+}
+
+// Predictor is implemented by layers whose forward pass can run without
+// recording anything for Backward. Sequential.Forward uses it so that a model
+// can serve inference from several goroutines at once.
+type Predictor interface {
+	Predict(inputs [][]float64) [][]float64
+}
+
+// predictLayer runs the forward pass of layer for inference, using Predict
+// when the layer implements Predictor.
+func predictLayer(layer Layer, inputs [][]float64) [][]float64 {
+	if p, ok := layer.(Predictor); ok {
+		return p.Predict(inputs)
+	}
+	return layer.Forward(inputs)
+}
+
+// Replicator is implemented by layers that support data-parallel training.
+// Replicate returns a layer that shares the parameter values of the original
+// but has its own gradients and cached activations.
+type Replicator interface {
+	Replicate() Layer
+}
+
+// wrapper is implemented by layers that apply another layer, so that checks
+// on the layers of a model can look inside them.
+type wrapper interface {
+	wrapped() Layer
+}
+
+// Buffered is implemented by layers that keep state besides their parameters,
+// such as running statistics. Buffers returns that state, which is saved and
+// loaded together with the weights but not trained.
+type Buffered interface {
+	Buffers() [][][]float64
+}
+
+// tensorParam is a Param whose values and gradients are views of contiguous
+// tensors, which layers use for their computations.
+type tensorParam struct {
+	*Param
+	value, grad *Tensor
+}
+
+func newTensorParam(rows, cols int) tensorParam {
+	value, grad := NewTensor(rows, cols), NewTensor(rows, cols)
+	return tensorParam{
+		Param: &Param{Value: value.Rows(), Grad: grad.Rows()},
+		value: value,
+		grad:  grad,
+	}
+}
+
+// share returns a parameter with the same values and settings but its own
+// gradients, for replicas used in data-parallel training.
+func (p tensorParam) share() tensorParam {
+	grad := NewTensor(p.grad.Shape...)
+	shared := *p.Param
+	shared.Grad = grad.Rows()
+	return tensorParam{Param: &shared, value: p.value, grad: grad}
+}
+
+// Dense is a fully connected layer followed by an activation.
+type Dense struct {
+	inputSize  int
+	outputSize int
+	// weights has one row per input and bias a single row.
+	weights    tensorParam
+	bias       tensorParam
+	activation Activation
+
+	inputs         *Tensor
+	preActivations [][]float64
+	outputs        [][]float64
+}
+
+// NewDense returns a fully connected layer with Xavier uniform weights and
+// zero biases. Activations can be looked up by name with GetActivation.
+func NewDense(inputSize, outputSize int, activation Activation) *Dense {
+	return NewDenseRand(inputSize, outputSize, activation, nil)
+}
+
+// NewDenseRand is like NewDense but draws the initial weights from rng.
+// A nil rng uses a shared source seeded with the current time.
+func NewDenseRand(inputSize, outputSize int, activation Activation, rng *rand.Rand) *Dense {
+	d := newDense(inputSize, outputSize, activation)
+	return d.Initialize(XavierUniform, Zeros, rng)
+}
+
+// Initialize re-initializes the weights and biases of the layer and returns
+// the layer. A nil weights initializer keeps the Xavier uniform default and a
+// nil bias initializer sets the biases to zero.
+func (d *Dense) Initialize(weights, bias Initializer, rng *rand.Rand) *Dense {
+	rng = randOrDefault(rng)
+	if weights == nil {
+		weights = XavierUniform
+	}
+	if bias == nil {
+		bias = Zeros
+	}
+	weights(d.weights.Value, d.inputSize, d.outputSize, rng)
+	bias(d.bias.Value, d.inputSize, d.outputSize, rng)
+	return d
+}
+
+func newDense(inputSize, outputSize int, activation Activation) *Dense {
+	return &Dense{
+		inputSize:  inputSize,
+		outputSize: outputSize,
+		weights:    newTensorParam(inputSize, outputSize),
+		bias:       newTensorParam(1, outputSize),
+		activation: activation,
+	}
+}
+
+// resized returns a layer of the given sizes with zero weights and the same
+// activation and regularization as d.
+func (d *Dense) resized(inputSize, outputSize int) *Dense {
+	r := newDense(inputSize, outputSize, d.activation)
+	r.weights.L1, r.weights.L2 = d.weights.L1, d.weights.L2
+	r.bias.L1, r.bias.L2 = d.bias.L1, d.bias.L2
+	return r
+}
+
+// SetActivation replaces the activation function of the layer.
+func (d *Dense) SetActivation(activation Activation) {
+	d.activation = activation
+}
+
+// SetRegularization sets the strengths of the L1 and L2 penalties on the
+// weights of the layer. Biases are not penalized.
+func (d *Dense) SetRegularization(l1, l2 float64) *Dense {
+	d.weights.L1 = l1
+	d.weights.L2 = l2
+	return d
+}
+
+func (d *Dense) Replicate() Layer {
+	return &Dense{
+		inputSize:  d.inputSize,
+		outputSize: d.outputSize,
+		weights:    d.weights.share(),
+		bias:       d.bias.share(),
+		activation: d.activation,
+	}
+}
+
+func (d *Dense) Forward(inputs [][]float64) [][]float64 {
+	x := batchTensor(inputs, d.inputSize)
+	preActivations, outputs := d.forward(x)
+	d.inputs = x
+	d.preActivations = preActivations
+	d.outputs = outputs
+	return outputs
+}
+
+func (d *Dense) Predict(inputs [][]float64) [][]float64 {
+	_, outputs := d.forward(batchTensor(inputs, d.inputSize))
+	return outputs
+}
+
+func (d *Dense) forward(x *Tensor) ([][]float64, [][]float64) {
+	z := MatMul(x, d.weights.value)
+	z.AddInPlace(d.bias.value)
+	preActivations := z.Rows()
+	outputs := make([][]float64, len(preActivations))
+	for n, row := range preActivations {
+		outputs[n] = d.activation.Apply(row)
+	}
+	return preActivations, outputs
+}
+
+// forwardInto writes the output of the layer for a single input to dst
+// without allocating when the activation can be applied in place.
+func (d *Dense) forwardInto(dst, input []float64) {
+	z := dst[:d.outputSize]
+	copy(z, d.bias.value.Data)
+	weights := d.weights.value.Data
+	for j, x := range input {
+		if x == 0 {
+			continue
+		}
+		for i, w := range weights[j*d.outputSize : (j+1)*d.outputSize] {
+			z[i] += x * w
+		}
+	}
+	if a, ok := d.activation.(inPlaceActivation); ok {
+		a.ApplyTo(z, z)
+	} else {
+		copy(z, d.activation.Apply(z))
+	}
+}
+
+func (d *Dense) Backward(grads [][]float64) [][]float64 {
+	deltas := make([][]float64, len(grads))
+	for n, grad := range grads {
+		deltas[n] = d.activation.Backward(d.preActivations[n], d.outputs[n], grad)
+	}
+	return d.backwardDelta(deltas)
+}
+
+// backwardDelta backpropagates gradients taken with respect to the
+// pre-activation values of the layer.
+func (d *Dense) backwardDelta(deltas [][]float64) [][]float64 {
+	delta := batchTensor(deltas, d.outputSize)
+	matMulAdd(d.weights.grad, d.inputs.Transpose(), delta)
+	d.bias.grad.AddInPlace(delta.Sum(0))
+	return MatMul(delta, d.weights.value.Transpose()).Rows()
+}
+
+func (d *Dense) Params() []*Param {
+	return []*Param{d.weights.Param, d.bias.Param}
+}
+
+func newMatrix(rows, cols int) [][]float64 {
+	return NewTensor(rows, cols).Rows()
+}
+
+// zerosLike returns a matrix of zeros with the shape of m, stored
+// contiguously.
+func zerosLike(m [][]float64) [][]float64 {
+	size := 0
+	for i := range m {
+		size += len(m[i])
+	}
+	data := make([]float64, size)
+	z := make([][]float64, len(m))
+	for i := range m {
+		z[i], data = data[:len(m[i]):len(m[i])], data[len(m[i]):]
+	}
+	return z
+}
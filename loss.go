@@ -0,0 +1,247 @@
+package gonn
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// epsilon keeps logarithms and divisions in the losses finite.
+const epsilon = 1e-12
+
+// Loss measures how far the output y of a model is from the target t.
+// Values are summed over the outputs of a single sample.
+type Loss interface {
+	Value(y, t []float64) float64
+	// Gradient returns the gradient of Value with respect to y.
+	Gradient(y, t []float64) []float64
+}
+
+// fusedLoss is implemented by losses whose gradient with respect to the
+// pre-activation of a matching output activation simplifies to y - t.
+type fusedLoss interface {
+	fuses(a Activation) bool
+}
+
+// MSE is half the sum of squared errors, which gives the y - t gradient used
+// by the original training loop.
+type MSE struct{}
+
+func (MSE) Value(y, t []float64) float64 {
+	sum := 0.0
+	for i := range y {
+		sum += (y[i] - t[i]) * (y[i] - t[i])
+	}
+	return sum / 2
+}
+
+func (MSE) Gradient(y, t []float64) []float64 {
+	grad := make([]float64, len(y))
+	for i := range y {
+		grad[i] = y[i] - t[i]
+	}
+	return grad
+}
+
+// MAE is the sum of absolute errors.
+type MAE struct{}
+
+func (MAE) Value(y, t []float64) float64 {
+	sum := 0.0
+	for i := range y {
+		sum += math.Abs(y[i] - t[i])
+	}
+	return sum
+}
+
+func (MAE) Gradient(y, t []float64) []float64 {
+	grad := make([]float64, len(y))
+	for i := range y {
+		if y[i] > t[i] {
+			grad[i] = 1
+		} else if y[i] < t[i] {
+			grad[i] = -1
+		}
+	}
+	return grad
+}
+
+// Huber is quadratic for errors smaller than Delta and linear beyond it.
+// A zero Delta is treated as 1.
+type Huber struct {
+	Delta float64
+}
+
+func (h Huber) delta() float64 {
+	if h.Delta == 0 {
+		return 1
+	}
+	return h.Delta
+}
+
+func (h Huber) Value(y, t []float64) float64 {
+	delta := h.delta()
+	sum := 0.0
+	for i := range y {
+		e := math.Abs(y[i] - t[i])
+		if e <= delta {
+			sum += e * e / 2
+		} else {
+			sum += delta * (e - delta/2)
+		}
+	}
+	return sum
+}
+
+func (h Huber) Gradient(y, t []float64) []float64 {
+	delta := h.delta()
+	grad := make([]float64, len(y))
+	for i := range y {
+		e := y[i] - t[i]
+		if e > delta {
+			grad[i] = delta
+		} else if e < -delta {
+			grad[i] = -delta
+		} else {
+			grad[i] = e
+		}
+	}
+	return grad
+}
+
+// CrossEntropy is the categorical cross-entropy for one-hot or probability
+// targets, meant to follow a softmax output.
+type CrossEntropy struct{}
+
+func (CrossEntropy) Value(y, t []float64) float64 {
+	sum := 0.0
+	for i := range y {
+		sum -= t[i] * math.Log(y[i]+epsilon)
+	}
+	return sum
+}
+
+func (CrossEntropy) Gradient(y, t []float64) []float64 {
+	grad := make([]float64, len(y))
+	for i := range y {
+		grad[i] = -t[i] / (y[i] + epsilon)
+	}
+	return grad
+}
+
+func (CrossEntropy) fuses(a Activation) bool {
+	_, ok := a.(softmax)
+	return ok
+}
+
+// BinaryCrossEntropy treats every output as an independent probability,
+// meant to follow a sigmoid output.
+type BinaryCrossEntropy struct{}
+
+func (BinaryCrossEntropy) Value(y, t []float64) float64 {
+	sum := 0.0
+	for i := range y {
+		sum -= t[i]*math.Log(y[i]+epsilon) + (1-t[i])*math.Log(1-y[i]+epsilon)
+	}
+	return sum
+}
+
+func (BinaryCrossEntropy) Gradient(y, t []float64) []float64 {
+	grad := make([]float64, len(y))
+	for i := range y {
+		grad[i] = (y[i] - t[i]) / (y[i]*(1-y[i]) + epsilon)
+	}
+	return grad
+}
+
+func (BinaryCrossEntropy) fuses(a Activation) bool {
+	return a == sigmoidActivation
+}
+
+// Hinge is the sum of max(0, 1 - t*y) over the outputs. Targets are expected
+// in {-1, 1}; a target of 0 is treated as -1 so one-hot labels work as is.
+type Hinge struct{}
+
+func hingeTarget(t float64) float64 {
+	if t <= 0 {
+		return -1
+	}
+	return 1
+}
+
+func (Hinge) Value(y, t []float64) float64 {
+	sum := 0.0
+	for i := range y {
+		sum += math.Max(0, 1-hingeTarget(t[i])*y[i])
+	}
+	return sum
+}
+
+func (Hinge) Gradient(y, t []float64) []float64 {
+	grad := make([]float64, len(y))
+	for i := range y {
+		if s := hingeTarget(t[i]); s*y[i] < 1 {
+			grad[i] = -s
+		}
+	}
+	return grad
+}
+
+// KLDivergence is the Kullback-Leibler divergence of the output distribution y
+// from the target distribution t.
+type KLDivergence struct{}
+
+func (KLDivergence) Value(y, t []float64) float64 {
+	sum := 0.0
+	for i := range y {
+		if t[i] > 0 {
+			sum += t[i] * math.Log(t[i]/(y[i]+epsilon))
+		}
+	}
+	return sum
+}
+
+func (KLDivergence) Gradient(y, t []float64) []float64 {
+	grad := make([]float64, len(y))
+	for i := range y {
+		grad[i] = -t[i] / (y[i] + epsilon)
+	}
+	return grad
+}
+
+func (KLDivergence) fuses(a Activation) bool {
+	_, ok := a.(softmax)
+	return ok
+}
+
+var (
+	lossesMu sync.RWMutex
+	losses   = map[string]Loss{
+		"mse":                  MSE{},
+		"mae":                  MAE{},
+		"huber":                Huber{},
+		"cross-entropy":        CrossEntropy{},
+		"binary-cross-entropy": BinaryCrossEntropy{},
+		"hinge":                Hinge{},
+		"kl-divergence":        KLDivergence{},
+	}
+)
+
+// RegisterLoss makes a user-defined loss available under name, replacing any
+// loss previously registered with that name.
+func RegisterLoss(name string, l Loss) {
+	lossesMu.Lock()
+	defer lossesMu.Unlock()
+	losses[name] = l
+}
+
+// GetLoss returns the loss registered under name.
+func GetLoss(name string) (Loss, error) {
+	lossesMu.RLock()
+	defer lossesMu.RUnlock()
+	l, ok := losses[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown loss function: %q", name)
+	}
+	return l, nil
+}
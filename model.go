@@ -4,27 +4,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"math"
 	"math/rand"
 	"os"
-	"time"
 	"encoding/gob"
 	"bytes"
+	"sync"
 )
 
+// NeuralNetwork is a Sequential model with one hidden layer. Its methods are
+// safe for concurrent use in the same way as those of Sequential.
 type NeuralNetwork struct {
-	inputSize  int
-	hiddenSize int
-	outputSize int
-	weights1   [][]float64
-	weights2   [][]float64
-	bias1      []float64
-	bias2      []float64
-	activationFunction1 func(float64)float64
-	activationFunction1Derivative func(float64)float64
-	activationFunction2 func(float64)float64
-	activationFunction2Derivative func(float64)float64
-	Score			 float64
+	*Sequential
+	Score float64
+	// once creates the Sequential of a zero NeuralNetwork.
+	once sync.Once
 }
 
 type Weights struct {
@@ -37,205 +30,171 @@ type Weights struct {
 	Bias2      []float64   `json:"biasO"`
 }
 
-func sigmoid(x float64) float64 {
-	return 1.0 / (1.0 + math.Exp(-x))
-}
-
-func sigmoidDerivative(x float64) float64 {
-	return sigmoid(x) * (1 - sigmoid(x))
-}
-
-func relu(x float64) float64 {
-	if x >= 0 {
-		return x
-	} else {
-		return 0
-	}
-}
-
-func reluDerivative(x float64) float64 {
-	if x >= 0 {
-		return 1
-	} else {
-		return 0
-	}
+// NewNeuralNetwork returns a network with one hidden layer. activationFunction
+// is a "hidden-output" pair accepted by SetActivationFunction; it panics if the
+// pair is unknown.
+func NewNeuralNetwork(inputSize, hiddenSize, outputSize int, activationFunction string) *NeuralNetwork {
+	return NewNeuralNetworkRand(inputSize, hiddenSize, outputSize, activationFunction, nil)
 }
 
-func NewNeuralNetwork(inputSize, hiddenSize, outputSize int, activationFunction string) *NeuralNetwork {
+// NewNeuralNetworkRand is like NewNeuralNetwork but draws the initial weights
+// from rng, so that a network can be reproduced from a seed. A nil rng uses a
+// shared source seeded with the current time.
+func NewNeuralNetworkRand(inputSize, hiddenSize, outputSize int, activationFunction string, rng *rand.Rand) *NeuralNetwork {
 	nn := &NeuralNetwork{
-		inputSize:  inputSize,
-		hiddenSize: hiddenSize,
-		outputSize: outputSize,
-		weights1:   make([][]float64, inputSize),
-		weights2:   make([][]float64, hiddenSize),
-		bias1:      make([]float64, hiddenSize),
-		bias2:      make([]float64, outputSize),
+		Sequential: NewSequential(
+			NewDenseRand(inputSize, hiddenSize, nil, rng),
+			NewDenseRand(hiddenSize, outputSize, nil, rng),
+		),
 	}
-
-	nn.SetActivationFunction(activationFunction)
-
-	rand.Seed(time.Now().UnixNano())
-
-	for i := range nn.weights1 {
-		nn.weights1[i] = make([]float64, nn.hiddenSize)
-		for j := range nn.weights1[i] {
-			nn.weights1[i][j] = rand.Float64()
-		}
+	if err := nn.SetActivationFunction(activationFunction); err != nil {
+		panic(err)
 	}
 
-	for i := range nn.weights2 {
-		nn.weights2[i] = make([]float64, nn.outputSize)
-		for j := range nn.weights2[i] {
-			nn.weights2[i][j] = rand.Float64()
-		}
-	}
+	return nn
+}
 
-	for i := range nn.bias1 {
-		nn.bias1[i] = rand.Float64()
+// SetActivationFunction sets the activations of the hidden and output layers
+// from a "hidden-output" pair of registered names such as "relu-sigmoid".
+// A softmax output trains with the cross-entropy loss unless another loss has
+// been set.
+func (nn *NeuralNetwork)SetActivationFunction(activationFunction string) error {
+	hiddenActivation, outputActivation, err := splitActivations(activationFunction)
+	if err != nil {
+		return err
 	}
+	s := nn.sequential()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hidden, output := nn.layers()
+	hidden.SetActivation(hiddenActivation)
+	output.SetActivation(outputActivation)
+
+	// softmax の出力は、損失が指定されていなければ交差エントロピーと組み合わせて学習する
+	nn.defaultLoss = outputLoss(outputActivation)
+	return nil
+}
 
-	for i := range nn.bias2 {
-		nn.bias2[i] = rand.Float64()
+// outputLoss returns the loss a network trains with by default for the given
+// output activation, or nil for MSE.
+func outputLoss(activation Activation) Loss {
+	if _, ok := activation.(softmax); ok {
+		return CrossEntropy{}
 	}
+	return nil
+}
 
-	return nn
+// sequential returns the model of the network, creating one with empty layers
+// for a zero NeuralNetwork so that activations can be set before loading.
+func (nn *NeuralNetwork) sequential() *Sequential {
+	nn.once.Do(func() {
+		if nn.Sequential == nil {
+			nn.Sequential = NewSequential(newDense(0, 0, nil), newDense(0, 0, nil))
+		}
+	})
+	return nn.Sequential
 }
 
-func (nn *NeuralNetwork)SetActivationFunction(activationFunction string){
-	if activationFunction == "relu-sigmoid" {
-		nn.activationFunction1 = relu
-		nn.activationFunction1Derivative = reluDerivative
-		nn.activationFunction2 = sigmoid
-		nn.activationFunction2Derivative = sigmoidDerivative
-	} else if activationFunction == "sigmoid-sigmoid" {
-		nn.activationFunction1 = sigmoid
-		nn.activationFunction1Derivative = sigmoidDerivative
-		nn.activationFunction2 = sigmoid
-		nn.activationFunction2Derivative = sigmoidDerivative
-	}
+// layers returns the hidden and output layers of the network. The caller must
+// hold the lock of the model returned by sequential.
+func (nn *NeuralNetwork) layers() (*Dense, *Dense) {
+	return nn.Layers[0].(*Dense), nn.Layers[1].(*Dense)
 }
 
 func (nn *NeuralNetwork)PrintSize(){
+	s := nn.sequential()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hidden, output := nn.layers()
 	fmt.Println("---------------------")
-	fmt.Println("input size:",nn.inputSize)
-	fmt.Println("hidden size:",nn.hiddenSize)
-	fmt.Println("output size:",nn.outputSize)
-	fmt.Println("nn.bias1 len:",len(nn.bias1))
-	fmt.Println("nn.bias2 len:",len(nn.bias2))
+	fmt.Println("input size:",hidden.inputSize)
+	fmt.Println("hidden size:",hidden.outputSize)
+	fmt.Println("output size:",output.outputSize)
+	fmt.Println("nn.bias1 len:",len(hidden.bias.Value[0]))
+	fmt.Println("nn.bias2 len:",len(output.bias.Value[0]))
 	fmt.Println("---------------------")
 }
 
-func (nn *NeuralNetwork) Forward(input []float64) []float64 {
-	hidden := make([]float64, nn.hiddenSize)
-	output := make([]float64, nn.outputSize)
-
-	for i := range hidden {
-		for j := range input {
-			hidden[i] += input[j] * nn.weights1[j][i]
-		}
-		hidden[i] = nn.activationFunction1(hidden[i] + nn.bias1[i])
+func (nn *NeuralNetwork) weights() Weights {
+	hidden, output := nn.layers()
+	return Weights{
+		InputSize:  hidden.inputSize,
+		HiddenSize: hidden.outputSize,
+		OutputSize: output.outputSize,
+		Weights1:   hidden.weights.Value,
+		Weights2:   output.weights.Value,
+		Bias1:      hidden.bias.Value[0],
+		Bias2:      output.bias.Value[0],
 	}
+}
 
-	for i := range output {
-		for j := range hidden {
-			output[i] += hidden[j] * nn.weights2[j][i]
-		}
-		output[i] = nn.activationFunction2(output[i] + nn.bias2[i])
+// setWeights copies weights into the network. The layers are only rebuilt
+// when the sizes change, so that the Params optimizers keep state for and the
+// regularization settings of the layers stay in place.
+func (nn *NeuralNetwork) setWeights(weights Weights) error {
+	weights.fillBiases()
+	if err := weights.check(); err != nil {
+		return err
 	}
-
-	return output
+	s := nn.sequential()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hidden, output := nn.layers()
+
+	// Sequential は他の goroutine と共有されうるので、差し替えずに層だけを入れ替える
+	if hidden.inputSize != weights.InputSize || hidden.outputSize != weights.HiddenSize || output.outputSize != weights.OutputSize {
+		hidden = hidden.resized(weights.InputSize, weights.HiddenSize)
+		output = output.resized(weights.HiddenSize, weights.OutputSize)
+		nn.Layers = []Layer{hidden, output}
+	}
+	for i := range hidden.weights.Value {
+		copy(hidden.weights.Value[i], weights.Weights1[i])
+	}
+	for i := range output.weights.Value {
+		copy(output.weights.Value[i], weights.Weights2[i])
+	}
+	copy(hidden.bias.Value[0], weights.Bias1)
+	copy(output.bias.Value[0], weights.Bias2)
+	return nil
 }
 
-func (nn *NeuralNetwork) TrainNeuralNetwork(inputs [][]float64, outputs [][]float64, learningRate float64, epochs int) {
-	for epoch := 0; epoch < epochs; epoch++ {
-		correct := 0 // 正解数をカウントするための変数
-		for i := range inputs {
-			input := inputs[i]
-			output := outputs[i]
-			hidden := make([]float64, nn.hiddenSize)
-			outputLayer := make([]float64, nn.outputSize)
-
-			// Forward propagation
-			for j := range hidden {
-				for k := range input {
-					hidden[j] += input[k] * nn.weights1[k][j]
-				}
-				hidden[j] = nn.activationFunction1(hidden[j] + nn.bias1[j])
-			}
-
-			for j := range outputLayer {
-				for k := range hidden {
-					outputLayer[j] += hidden[k] * nn.weights2[k][j]
-				}
-				outputLayer[j] = nn.activationFunction2(outputLayer[j] + nn.bias2[j])
-			}
-
-			// 正解数をカウントする
-			prediction := 0
-			for j, val := range outputLayer {
-				if val > outputLayer[prediction] {
-					prediction = j
-				}
-			}
-			if output[prediction] == 1 {
-				correct++
-			}
-
-			// Backpropagation
-			outputLayerError := make([]float64, nn.outputSize)
-			for j := range outputLayer {
-				outputLayerError[j] = output[j] - outputLayer[j]
-			}
-
-			outputLayerDelta := make([]float64, nn.outputSize)
-			for j := range outputLayerDelta {
-				outputLayerDelta[j] = outputLayerError[j] * nn.activationFunction2Derivative(outputLayer[j])
-			}
-
-			hiddenError := make([]float64, nn.hiddenSize)
-			for j := range hidden {
-				for k := range outputLayerDelta {
-					hiddenError[j] += outputLayerDelta[k] * nn.weights2[j][k]
-				}
-			}
-
-			hiddenDelta := make([]float64, nn.hiddenSize)
-			for j := range hiddenDelta {
-				hiddenDelta[j] = hiddenError[j] * nn.activationFunction1Derivative(hidden[j])
-			}
+// fillBiases sets missing biases to zeros, as for files saved before biases
+// were stored.
+func (w *Weights) fillBiases() {
+	if len(w.Bias1) == 0 {
+		w.Bias1 = make([]float64, w.HiddenSize)
+	}
+	if len(w.Bias2) == 0 {
+		w.Bias2 = make([]float64, w.OutputSize)
+	}
+}
 
-			// Update weights and biases
-			for j := range nn.bias2 {
-				nn.bias2[j] += learningRate * outputLayerDelta[j]
-				for k := range hidden {
-					nn.weights2[k][j] += learningRate * outputLayerDelta[j] * hidden[k]
-				}
-			}
+// check returns an error if the matrices do not match the sizes.
+func (w Weights) check() error {
+	if !hasShape(w.Weights1, w.InputSize, w.HiddenSize) || !hasShape(w.Weights2, w.HiddenSize, w.OutputSize) ||
+		len(w.Bias1) != w.HiddenSize || len(w.Bias2) != w.OutputSize {
+		return fmt.Errorf("weights do not match the sizes %d-%d-%d", w.InputSize, w.HiddenSize, w.OutputSize)
+	}
+	return nil
+}
 
-			for j := range nn.bias1 {
-				nn.bias1[j] += learningRate * hiddenDelta[j]
-				for k := range input {
-					nn.weights1[k][j] += learningRate * hiddenDelta[j] * input[k]
-				}
-			}
+func hasShape(m [][]float64, rows, cols int) bool {
+	if len(m) != rows {
+		return false
+	}
+	for _, row := range m {
+		if len(row) != cols {
+			return false
 		}
-
-		// トレーニングセット全体に対する正答率を出力する
-		accuracy := float64(correct) / float64(len(inputs)) * 100.0
-		fmt.Printf("epoch: %d, accuracy: %f\n", epoch, accuracy)
 	}
+	return true
 }
 
 func (nn *NeuralNetwork) SaveWeights(filepath string) error {
-	weights := Weights{
-		InputSize:  nn.inputSize,
-		HiddenSize: nn.hiddenSize,
-		OutputSize: nn.outputSize,
-		Weights1:   nn.weights1,
-		Weights2:   nn.weights2,
-		Bias1:      nn.bias1,
-		Bias2:      nn.bias2,
-	}
+	s := nn.sequential()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	weights := nn.weights()
 
 	file, err := os.Create(filepath)
 	if err != nil {
@@ -265,112 +224,80 @@ func (nn *NeuralNetwork) LoadWeights(filepath string) error {
 		return err
 	}
 
-	nn.inputSize = weights.InputSize
-	nn.hiddenSize = weights.HiddenSize
-	nn.outputSize = weights.OutputSize
-	nn.weights1 = weights.Weights1
-	nn.weights2 = weights.Weights2
-	nn.bias1 = weights.Bias1
-	nn.bias2 = weights.Bias2
-
-	if len(nn.bias1) == 0 {
-		nn.bias1 = make([]float64, nn.hiddenSize)
-	}
-	if len(nn.bias2) == 0 {
-		nn.bias2 = make([]float64, nn.outputSize)
-	}
-
-	return nil
+	return nn.setWeights(weights)
 }
 
 // 遺伝的アルゴリズムにおける交配
 func Crossover(parents []*NeuralNetwork, numChildren int, mutationRate float64) []*NeuralNetwork {
+	return CrossoverRand(parents, numChildren, mutationRate, nil)
+}
+
+// CrossoverRand is like Crossover but draws every random choice from rng, so
+// that a run of the genetic algorithm can be replayed from a seed. A nil rng
+// uses a shared source seeded with the current time.
+func CrossoverRand(parents []*NeuralNetwork, numChildren int, mutationRate float64, rng *rand.Rand) []*NeuralNetwork {
+	rng = randOrDefault(rng)
 	children := make([]*NeuralNetwork, numChildren)
-	rand.Seed(time.Now().UnixNano())
-	for i := 0; i < numChildren; i++ {
-		child := &NeuralNetwork{
-			inputSize:                   parents[0].inputSize,
-			hiddenSize:                  parents[0].hiddenSize,
-			outputSize:                  parents[0].outputSize,
-			weights1:                    make([][]float64, parents[0].inputSize),
-			weights2:                    make([][]float64, parents[0].hiddenSize),
-			bias1:                       make([]float64, parents[0].hiddenSize),
-			bias2:                       make([]float64, parents[0].outputSize),
-			activationFunction1:         parents[0].activationFunction1,
-			activationFunction1Derivative: parents[0].activationFunction1Derivative,
-			activationFunction2:         parents[0].activationFunction2,
-			activationFunction2Derivative: parents[0].activationFunction2Derivative,
-		}
 
-		for j := range child.weights1 {
-			child.weights1[j] = make([]float64, child.hiddenSize)
-			for k := range child.weights1[j] {
-				if rand.Float64() < 0.5 {
-					child.weights1[j][k] = parents[0].weights1[j][k]
-				} else {
-					child.weights1[j][k] = parents[1].weights1[j][k]
-				}
+	// 親は他の goroutine で推論や学習に使われうるので、ロックして重みを複製する
+	parent := parents[0].sequential()
+	parent.mu.RLock()
+	hidden, output := parents[0].layers()
+	hidden, output = hidden.resized(hidden.inputSize, hidden.outputSize), output.resized(output.inputSize, output.outputSize)
+	parent.mu.RUnlock()
+	values0 := parents[0].copyParams(nil)
+	values1 := parents[1].sequential().copyParams(nil)
 
-				if rand.Float64() < mutationRate {
-					child.weights1[j][k] += rand.Float64() - 0.5
-				}
-			}
+	for i := 0; i < numChildren; i++ {
+		child := &NeuralNetwork{
+			Sequential: NewSequential(
+				hidden.resized(hidden.inputSize, hidden.outputSize),
+				output.resized(output.inputSize, output.outputSize),
+			),
 		}
-
-		for j := range child.weights2 {
-			child.weights2[j] = make([]float64, child.outputSize)
-			for k := range child.weights2[j] {
-				if rand.Float64() < 0.5 {
-					child.weights2[j][k] = parents[0].weights2[j][k]
-				} else {
-					child.weights2[j][k] = parents[1].weights2[j][k]
-				}
-
-				if rand.Float64() < mutationRate {
-					child.weights2[j][k] += rand.Float64() - 0.5
+		child.defaultLoss = outputLoss(output.activation)
+
+		for p, param := range child.Params() {
+			for j := range param.Value {
+				for k := range param.Value[j] {
+					if rng.Float64() < 0.5 {
+						param.Value[j][k] = values0[p][j][k]
+					} else {
+						param.Value[j][k] = values1[p][j][k]
+					}
 				}
 			}
 		}
+		child.Mutate(mutationRate, rng)
 
-		for j := range child.bias1 {
-			if rand.Float64() < 0.5 {
-				child.bias1[j] = parents[0].bias1[j]
-			} else {
-				child.bias1[j] = parents[1].bias1[j]
-			}
+		children[i] = child
+	}
 
-			if rand.Float64() < mutationRate {
-				child.bias1[j] += rand.Float64() - 0.5
-			}
-		}
+	return children
+}
 
-		for j := range child.bias2 {
-			if rand.Float64() < 0.5 {
-				child.bias2[j] = parents[0].bias2[j]
-			} else {
-				child.bias2[j] = parents[1].bias2[j]
-			}
-			if rand.Float64() < mutationRate {
-				child.bias2[j] += rand.Float64() - 0.5
+// 突然変異: 各パラメータを mutationRate の確率で [-0.5, 0.5) の範囲でずらす
+func (nn *NeuralNetwork) Mutate(mutationRate float64, rng *rand.Rand) {
+	rng = randOrDefault(rng)
+	s := nn.sequential()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, param := range s.Params() {
+		for j := range param.Value {
+			for k := range param.Value[j] {
+				if rng.Float64() < mutationRate {
+					param.Value[j][k] += rng.Float64() - 0.5
+				}
 			}
 		}
-	
-		children[i] = child
 	}
-	
-	return children
 }
 
 func (nn *NeuralNetwork) SaveWeightsBinary(filepath string) error {
-	weights := Weights{
-		InputSize:  nn.inputSize,
-		HiddenSize: nn.hiddenSize,
-		OutputSize: nn.outputSize,
-		Weights1:   nn.weights1,
-		Weights2:   nn.weights2,
-		Bias1:      nn.bias1,
-		Bias2:      nn.bias2,
-	}
+	s := nn.sequential()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	weights := nn.weights()
 
 	file, err := os.Create(filepath)
 	if err != nil {
@@ -403,28 +330,17 @@ func (nn *NeuralNetwork) LoadWeightsBinary(filepath string) error {
 		return err
 	}
 
-	nn.inputSize = weights.InputSize
-	nn.hiddenSize = weights.HiddenSize
-	nn.outputSize = weights.OutputSize
-	nn.weights1 = weights.Weights1
-	nn.weights2 = weights.Weights2
-	nn.bias1 = weights.Bias1
-	nn.bias2 = weights.Bias2
-
-	if len(nn.bias1) == 0 {
-		nn.bias1 = make([]float64, nn.hiddenSize)
-	}
-	if len(nn.bias2) == 0 {
-		nn.bias2 = make([]float64, nn.outputSize)
-	}
-
-	return nil
+	return nn.setWeights(weights)
 }
 
 // GetWeight1 returns the weight from input layer i to hidden layer j
 func (nn *NeuralNetwork) GetWeight1(i, j int) float64 {
-	if i >= 0 && i < nn.inputSize && j >= 0 && j < nn.hiddenSize {
-		return nn.weights1[i][j]
+	s := nn.sequential()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hidden, _ := nn.layers()
+	if i >= 0 && i < hidden.inputSize && j >= 0 && j < hidden.outputSize {
+		return hidden.weights.Value[i][j]
 	}
 	fmt.Println("Invalid index")
 	return 0
@@ -432,8 +348,12 @@ func (nn *NeuralNetwork) GetWeight1(i, j int) float64 {
 
 // GetWeight2 returns the weight from hidden layer i to output layer j
 func (nn *NeuralNetwork) GetWeight2(i, j int) float64 {
-	if i >= 0 && i < nn.hiddenSize && j >= 0 && j < nn.outputSize {
-		return nn.weights2[i][j]
+	s := nn.sequential()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, output := nn.layers()
+	if i >= 0 && i < output.inputSize && j >= 0 && j < output.outputSize {
+		return output.weights.Value[i][j]
 	}
 	fmt.Println("Invalid index")
 	return 0
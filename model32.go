@@ -0,0 +1,271 @@
+package gonn
+
+import (
+	"fmt"
+	"sync"
+)
+
+// NeuralNetwork32 is a NeuralNetwork with float32 weights for inference. It
+// takes half the memory of a NeuralNetwork and is converted to and from one
+// with NeuralNetwork.Float32 and Float64 for training. Forward and saving the
+// weights are safe for concurrent use with each other and with loading.
+type NeuralNetwork32 struct {
+	Score float64
+
+	// mu guards the weights and activations.
+	mu sync.RWMutex
+
+	inputSize  int
+	hiddenSize int
+	outputSize int
+	// weights1 and weights2 are stored row by row, one row per input.
+	weights1, weights2 []float32
+	bias1, bias2       []float32
+
+	hiddenActivation Activation
+	outputActivation Activation
+}
+
+// Weights32 is the serialized form of a NeuralNetwork32. It uses the same
+// field names as Weights, so either model can load the JSON files of the
+// other.
+type Weights32 struct {
+	InputSize  int         `json:"inputSize"`
+	HiddenSize int         `json:"hiddenSize"`
+	OutputSize int         `json:"outputSize"`
+	Weights1   [][]float32 `json:"wi"`
+	Weights2   [][]float32 `json:"wo"`
+	Bias1      []float32   `json:"biasI"`
+	Bias2      []float32   `json:"biasO"`
+}
+
+// NewNeuralNetwork32 is like NewNeuralNetwork but returns a float32 network.
+func NewNeuralNetwork32(inputSize, hiddenSize, outputSize int, activationFunction string) *NeuralNetwork32 {
+	return NewNeuralNetwork(inputSize, hiddenSize, outputSize, activationFunction).Float32()
+}
+
+// Float32 returns a float32 copy of the network with the same activations.
+func (nn *NeuralNetwork) Float32() *NeuralNetwork32 {
+	s := nn.sequential()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hidden, output := nn.layers()
+	nn32 := &NeuralNetwork32{
+		Score:            nn.Score,
+		hiddenActivation: hidden.activation,
+		outputActivation: output.activation,
+	}
+	nn32.setWeights(toWeights32(nn.weights()))
+	return nn32
+}
+
+// Float64 returns a float64 copy of the network with the same activations,
+// which can be trained.
+func (nn *NeuralNetwork32) Float64() *NeuralNetwork {
+	w := nn.weights()
+	weights := Weights{
+		InputSize:  w.InputSize,
+		HiddenSize: w.HiddenSize,
+		OutputSize: w.OutputSize,
+		Weights1:   toFloat64Matrix(w.Weights1),
+		Weights2:   toFloat64Matrix(w.Weights2),
+		Bias1:      toFloat64(w.Bias1),
+		Bias2:      toFloat64(w.Bias2),
+	}
+	nn.mu.RLock()
+	nn64 := &NeuralNetwork{
+		Score:      nn.Score,
+		Sequential: NewSequential(newDense(0, 0, nn.hiddenActivation), newDense(0, 0, nn.outputActivation)),
+	}
+	nn64.defaultLoss = outputLoss(nn.outputActivation)
+	nn.mu.RUnlock()
+	if err := nn64.setWeights(weights); err != nil {
+		panic(err)
+	}
+	return nn64
+}
+
+// SetActivationFunction sets the activations of the hidden and output layers
+// from a "hidden-output" pair of registered names such as "relu-sigmoid".
+func (nn *NeuralNetwork32) SetActivationFunction(activationFunction string) error {
+	hiddenActivation, outputActivation, err := splitActivations(activationFunction)
+	if err != nil {
+		return err
+	}
+	nn.mu.Lock()
+	defer nn.mu.Unlock()
+	nn.hiddenActivation = hiddenActivation
+	nn.outputActivation = outputActivation
+	return nil
+}
+
+// Forward returns the output of the network for input.
+func (nn *NeuralNetwork32) Forward(input []float32) []float32 {
+	nn.mu.RLock()
+	defer nn.mu.RUnlock()
+	hidden := dense32(input, nn.weights1, nn.bias1, nn.hiddenSize, nn.hiddenActivation)
+	return dense32(hidden, nn.weights2, nn.bias2, nn.outputSize, nn.outputActivation)
+}
+
+// dense32 computes a fully connected layer in float32. The activation is
+// applied in float64.
+func dense32(input, weights, bias []float32, size int, activation Activation) []float32 {
+	z := make([]float32, size)
+	copy(z, bias)
+	for j, x := range input {
+		for i, w := range weights[j*size : (j+1)*size] {
+			z[i] += x * w
+		}
+	}
+	return toFloat32(activation.Apply(toFloat64(z)))
+}
+
+// weights returns the weights of the network. Loading replaces the slices of
+// the network instead of writing to them, so the result stays valid.
+func (nn *NeuralNetwork32) weights() Weights32 {
+	nn.mu.RLock()
+	defer nn.mu.RUnlock()
+	return Weights32{
+		InputSize:  nn.inputSize,
+		HiddenSize: nn.hiddenSize,
+		OutputSize: nn.outputSize,
+		Weights1:   rows32(nn.weights1, nn.inputSize, nn.hiddenSize),
+		Weights2:   rows32(nn.weights2, nn.hiddenSize, nn.outputSize),
+		Bias1:      nn.bias1,
+		Bias2:      nn.bias2,
+	}
+}
+
+func (nn *NeuralNetwork32) setWeights(weights Weights32) error {
+	weights.fillBiases()
+	if err := weights.check(); err != nil {
+		return err
+	}
+	nn.mu.Lock()
+	defer nn.mu.Unlock()
+	nn.inputSize = weights.InputSize
+	nn.hiddenSize = weights.HiddenSize
+	nn.outputSize = weights.OutputSize
+	nn.weights1 = flatten32(weights.Weights1)
+	nn.weights2 = flatten32(weights.Weights2)
+	nn.bias1 = append([]float32(nil), weights.Bias1...)
+	nn.bias2 = append([]float32(nil), weights.Bias2...)
+	return nil
+}
+
+// fillBiases sets missing biases to zeros like Weights.fillBiases.
+func (w *Weights32) fillBiases() {
+	if len(w.Bias1) == 0 {
+		w.Bias1 = make([]float32, w.HiddenSize)
+	}
+	if len(w.Bias2) == 0 {
+		w.Bias2 = make([]float32, w.OutputSize)
+	}
+}
+
+// check returns an error if the matrices do not match the sizes.
+func (w Weights32) check() error {
+	if !hasShape32(w.Weights1, w.InputSize, w.HiddenSize) || !hasShape32(w.Weights2, w.HiddenSize, w.OutputSize) ||
+		len(w.Bias1) != w.HiddenSize || len(w.Bias2) != w.OutputSize {
+		return fmt.Errorf("weights do not match the sizes %d-%d-%d", w.InputSize, w.HiddenSize, w.OutputSize)
+	}
+	return nil
+}
+
+func hasShape32(m [][]float32, rows, cols int) bool {
+	if len(m) != rows {
+		return false
+	}
+	for _, row := range m {
+		if len(row) != cols {
+			return false
+		}
+	}
+	return true
+}
+
+func (nn *NeuralNetwork32) SaveWeights(filepath string) error {
+	return saveJSON(filepath, nn.weights())
+}
+
+// LoadWeights loads weights saved by NeuralNetwork32.SaveWeights or
+// NeuralNetwork.SaveWeights.
+func (nn *NeuralNetwork32) LoadWeights(filepath string) error {
+	weights := Weights32{}
+	if err := loadJSON(filepath, &weights); err != nil {
+		return err
+	}
+	return nn.setWeights(weights)
+}
+
+func (nn *NeuralNetwork32) SaveWeightsBinary(filepath string) error {
+	return saveGob(filepath, nn.weights())
+}
+
+func (nn *NeuralNetwork32) LoadWeightsBinary(filepath string) error {
+	weights := Weights32{}
+	if err := loadGob(filepath, &weights); err != nil {
+		return err
+	}
+	return nn.setWeights(weights)
+}
+
+func toWeights32(w Weights) Weights32 {
+	return Weights32{
+		InputSize:  w.InputSize,
+		HiddenSize: w.HiddenSize,
+		OutputSize: w.OutputSize,
+		Weights1:   toFloat32Matrix(w.Weights1),
+		Weights2:   toFloat32Matrix(w.Weights2),
+		Bias1:      toFloat32(w.Bias1),
+		Bias2:      toFloat32(w.Bias2),
+	}
+}
+
+func flatten32(m [][]float32) []float32 {
+	var flat []float32
+	for _, row := range m {
+		flat = append(flat, row...)
+	}
+	return flat
+}
+
+func rows32(flat []float32, rows, cols int) [][]float32 {
+	m := make([][]float32, rows)
+	for i := range m {
+		m[i] = flat[i*cols : (i+1)*cols]
+	}
+	return m
+}
+
+func toFloat32(values []float64) []float32 {
+	converted := make([]float32, len(values))
+	for i, v := range values {
+		converted[i] = float32(v)
+	}
+	return converted
+}
+
+func toFloat64(values []float32) []float64 {
+	converted := make([]float64, len(values))
+	for i, v := range values {
+		converted[i] = float64(v)
+	}
+	return converted
+}
+
+func toFloat32Matrix(m [][]float64) [][]float32 {
+	converted := make([][]float32, len(m))
+	for i := range m {
+		converted[i] = toFloat32(m[i])
+	}
+	return converted
+}
+
+func toFloat64Matrix(m [][]float32) [][]float64 {
+	converted := make([][]float64, len(m))
+	for i := range m {
+		converted[i] = toFloat64(m[i])
+	}
+	return converted
+}
@@ -0,0 +1,107 @@
+package gonn
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFloat32RoundTrip(t *testing.T) {
+	nn := NewNeuralNetworkRand(5, 4, 3, "tanh-sigmoid", rand.New(rand.NewSource(1)))
+	nn32 := nn.Float32()
+	back := nn32.Float64()
+
+	// float32 に丸めた重みを float64 に戻しても、差は float32 の精度の範囲に収まる
+	for p, values := range nn.copyParams(nil) {
+		for j := range values {
+			for k, v := range values[j] {
+				if got := back.Params()[p].Value[j][k]; got != float64(float32(v)) {
+					t.Fatalf("param %d[%d][%d] = %v, want %v", p, j, k, got, float64(float32(v)))
+				}
+			}
+		}
+	}
+	input := []float64{0.1, -0.2, 0.3, -0.4, 0.5}
+	expected := nn.Forward(input)
+	for _, output := range [][]float64{toFloat64(nn32.Forward(toFloat32(input))), back.Forward(input)} {
+		for i := range expected {
+			if math.Abs(output[i]-expected[i]) > 1e-6 {
+				t.Errorf("output = %v, want %v", output, expected)
+				break
+			}
+		}
+	}
+}
+
+func TestNeuralNetwork32SaveLoad(t *testing.T) {
+	nn32 := NewNeuralNetworkRand(5, 4, 3, "relu-sigmoid", rand.New(rand.NewSource(1))).Float32()
+	dir := t.TempDir()
+	for _, c := range []struct {
+		name string
+		save func(*NeuralNetwork32, string) error
+		load func(*NeuralNetwork32, string) error
+	}{
+		{"json", (*NeuralNetwork32).SaveWeights, (*NeuralNetwork32).LoadWeights},
+		{"gob", (*NeuralNetwork32).SaveWeightsBinary, (*NeuralNetwork32).LoadWeightsBinary},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(dir, c.name)
+			if err := c.save(nn32, path); err != nil {
+				t.Fatal(err)
+			}
+			loaded := &NeuralNetwork32{}
+			if err := loaded.SetActivationFunction("relu-sigmoid"); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.load(loaded, path); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(loaded.weights(), nn32.weights()) {
+				t.Error("loaded weights differ from the saved ones")
+			}
+			input := []float32{1, 0, -1, 0.5, 0}
+			if got, want := loaded.Forward(input), nn32.Forward(input); !reflect.DeepEqual(got, want) {
+				t.Errorf("Forward = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNeuralNetwork32LoadWeightsWithoutBiases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weights.json")
+	data := `{"inputSize":2,"hiddenSize":3,"outputSize":1,"wi":[[1,2,3],[4,5,6]],"wo":[[1],[2],[3]]}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	nn32 := NewNeuralNetwork32(4, 4, 4, "linear-linear")
+	if err := nn32.LoadWeights(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := nn32.Forward([]float32{1, 1}); len(got) != 1 || got[0] != 46 {
+		t.Errorf("Forward = %v, want [46]", got)
+	}
+}
+
+func TestNeuralNetwork32LoadWeightsRejectsWrongSizes(t *testing.T) {
+	for name, data := range map[string]string{
+		"bias":        `{"inputSize":2,"hiddenSize":3,"outputSize":1,"wi":[[1,2,3],[4,5,6]],"wo":[[1],[2],[3]],"biasO":[1,2]}`,
+		"rows":        `{"inputSize":2,"hiddenSize":3,"outputSize":1,"wi":[[1,2,3],[4,5,6]],"wo":[[1],[2]]}`,
+		"short row":   `{"inputSize":2,"hiddenSize":3,"outputSize":1,"wi":[[1,2,3],[4,5]],"wo":[[1],[2],[3]]}`,
+		"long row":    `{"inputSize":2,"hiddenSize":3,"outputSize":1,"wi":[[1,2,3],[4,5,6,7]],"wo":[[1],[2],[3]]}`,
+		"long output": `{"inputSize":2,"hiddenSize":3,"outputSize":1,"wi":[[1,2,3],[4,5,6]],"wo":[[1],[2,2],[3]]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "weights.json")
+			if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := NewNeuralNetwork32(2, 3, 1, "linear-linear").LoadWeights(path); err == nil {
+				t.Error("LoadWeights returned no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package gonn
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestLoadWeightsWithoutBiases loads a file in the format of
+// sample/osero/trained_data.json, which has no biasI and biasO keys.
+func TestLoadWeightsWithoutBiases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weights.json")
+	data := `{"inputSize":2,"hiddenSize":3,"outputSize":1,"wi":[[1,2,3],[4,5,6]],"wo":[[1],[2],[3]]}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	nn := NewNeuralNetwork(4, 4, 4, "linear-linear")
+	if err := nn.LoadWeights(path); err != nil {
+		t.Fatal(err)
+	}
+	// 入力 (1, 1) の隠れ層は (5, 7, 9)、出力は 5 + 14 + 27 = 46
+	if got := nn.Forward([]float64{1, 1}); len(got) != 1 || got[0] != 46 {
+		t.Errorf("Forward = %v, want [46]", got)
+	}
+}
+
+func TestLoadWeightsRejectsWrongSizes(t *testing.T) {
+	for name, data := range map[string]string{
+		"bias":   `{"inputSize":2,"hiddenSize":3,"outputSize":1,"wi":[[1,2,3],[4,5,6]],"wo":[[1],[2],[3]],"biasI":[1,2]}`,
+		"rows":   `{"inputSize":2,"hiddenSize":3,"outputSize":1,"wi":[[1,2,3]],"wo":[[1],[2],[3]]}`,
+		"column": `{"inputSize":2,"hiddenSize":3,"outputSize":1,"wi":[[1,2,3],[4,5]],"wo":[[1],[2],[3]]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "weights.json")
+			if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := NewNeuralNetwork(2, 3, 1, "linear-linear").LoadWeights(path); err == nil {
+				t.Error("LoadWeights returned no error")
+			}
+		})
+	}
+}
+
+func TestSaveOptimizerStateBeforeTraining(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := NewSequential(NewDenseRand(2, 3, mustActivation(t, "relu"), rng), NewDenseRand(3, 1, nil, rng))
+	path := filepath.Join(t.TempDir(), "optimizer.json")
+	optimizer := NewAdam(0.01)
+	if err := s.SaveOptimizerState(path, optimizer); err != nil {
+		t.Fatal(err)
+	}
+	if len(optimizer.state.slots) != 0 {
+		t.Errorf("SaveOptimizerState stored slots for %d parameters", len(optimizer.state.slots))
+	}
+
+	// 保存した状態は、まだ学習していないオプティマイザの状態と同じになる
+	loaded := NewAdam(0.01)
+	if err := s.LoadOptimizerState(path, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.State(s.Params()), optimizer.State(s.Params()); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded state = %v, want %v", got, want)
+	}
+}
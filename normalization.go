@@ -0,0 +1,175 @@
+package gonn
+
+import (
+	"math"
+)
+
+// BatchNorm normalizes every feature over the samples of a batch and then
+// applies a trainable scale and shift. During training it uses the statistics
+// of the batch and keeps running averages of them, which are used instead at
+// inference time and saved with the weights.
+type BatchNorm struct {
+	// Momentum is the weight of the previous running statistics when they are
+	// updated with those of a batch.
+	Momentum float64
+	Epsilon  float64
+
+	size        int
+	gamma, beta tensorParam
+	runningMean *Tensor
+	runningVar  *Tensor
+
+	normalized *Tensor
+	invStd     *Tensor
+}
+
+// NewBatchNorm returns a batch normalization layer for size features with a
+// momentum of 0.9 and an epsilon of 1e-5.
+func NewBatchNorm(size int) *BatchNorm {
+	b := &BatchNorm{
+		Momentum:    0.9,
+		Epsilon:     1e-5,
+		size:        size,
+		gamma:       newNormParam(size, 1),
+		beta:        newNormParam(size, 0),
+		runningMean: NewTensor(1, size),
+		runningVar:  NewTensor(1, size),
+	}
+	Constant(1)(b.runningVar.Rows(), size, size, nil)
+	return b
+}
+
+func newNormParam(size int, v float64) tensorParam {
+	p := newTensorParam(1, size)
+	Constant(v)(p.Value, size, size, nil)
+	return p
+}
+
+func (b *BatchNorm) Forward(inputs [][]float64) [][]float64 {
+	x := batchTensor(inputs, b.size)
+	mean := x.Mean(0)
+	centered := Sub(x, mean)
+	variance := Mul(centered, centered).Mean(0)
+
+	// 推論時に使う移動平均を更新する
+	for i := 0; i < b.size; i++ {
+		b.runningMean.Data[i] = b.Momentum*b.runningMean.Data[i] + (1-b.Momentum)*mean.Data[i]
+		b.runningVar.Data[i] = b.Momentum*b.runningVar.Data[i] + (1-b.Momentum)*variance.Data[i]
+	}
+
+	b.invStd = variance.Apply(b.inverseStd)
+	b.normalized = Mul(centered, b.invStd)
+	return Add(Mul(b.normalized, b.gamma.value), b.beta.value).Rows()
+}
+
+func (b *BatchNorm) inverseStd(variance float64) float64 {
+	return 1 / math.Sqrt(variance+b.Epsilon)
+}
+
+func (b *BatchNorm) Predict(inputs [][]float64) [][]float64 {
+	x := batchTensor(inputs, b.size)
+	normalized := Mul(Sub(x, b.runningMean), b.runningVar.Apply(b.inverseStd))
+	return Add(Mul(normalized, b.gamma.value), b.beta.value).Rows()
+}
+
+func (b *BatchNorm) Backward(grads [][]float64) [][]float64 {
+	g := batchTensor(grads, b.size)
+	n := float64(len(grads))
+	b.gamma.grad.AddInPlace(Mul(g, b.normalized).Sum(0))
+	b.beta.grad.AddInPlace(g.Sum(0))
+
+	// dx = invStd / n * (n * dxhat - sum(dxhat) - xhat * sum(dxhat * xhat))
+	dNormalized := Mul(g, b.gamma.value)
+	sum := dNormalized.Sum(0)
+	dot := Mul(dNormalized, b.normalized).Sum(0)
+	inputGrads := Sub(Sub(dNormalized.Scale(n), sum), Mul(b.normalized, dot))
+	return Mul(inputGrads, b.invStd.Scale(1/n)).Rows()
+}
+
+func (b *BatchNorm) Params() []*Param {
+	return []*Param{b.gamma.Param, b.beta.Param}
+}
+
+// Buffers returns the running mean and variance.
+func (b *BatchNorm) Buffers() [][][]float64 {
+	return [][][]float64{b.runningMean.Rows(), b.runningVar.Rows()}
+}
+
+// Replicate returns a layer sharing the scale and shift. The replica keeps its
+// own running statistics, so in data-parallel training they are only tracked
+// on the shard of the first worker.
+func (b *BatchNorm) Replicate() Layer {
+	r := NewBatchNorm(b.size)
+	r.Momentum, r.Epsilon = b.Momentum, b.Epsilon
+	r.gamma, r.beta = b.gamma.share(), b.beta.share()
+	return r
+}
+
+// LayerNorm normalizes every sample over its features and then applies a
+// trainable scale and shift. It behaves the same during training and
+// inference.
+type LayerNorm struct {
+	Epsilon float64
+
+	size        int
+	gamma, beta tensorParam
+
+	normalized *Tensor
+	invStd     *Tensor
+}
+
+// NewLayerNorm returns a layer normalization layer for size features with an
+// epsilon of 1e-5.
+func NewLayerNorm(size int) *LayerNorm {
+	return &LayerNorm{
+		Epsilon: 1e-5,
+		size:    size,
+		gamma:   newNormParam(size, 1),
+		beta:    newNormParam(size, 0),
+	}
+}
+
+func (l *LayerNorm) Forward(inputs [][]float64) [][]float64 {
+	outputs, normalized, invStd := l.forward(inputs)
+	l.normalized, l.invStd = normalized, invStd
+	return outputs
+}
+
+func (l *LayerNorm) Predict(inputs [][]float64) [][]float64 {
+	outputs, _, _ := l.forward(inputs)
+	return outputs
+}
+
+func (l *LayerNorm) forward(inputs [][]float64) ([][]float64, *Tensor, *Tensor) {
+	x := batchTensor(inputs, l.size)
+	centered := Sub(x, x.Mean(1))
+	invStd := Mul(centered, centered).Mean(1).Apply(func(variance float64) float64 {
+		return 1 / math.Sqrt(variance+l.Epsilon)
+	})
+	normalized := Mul(centered, invStd)
+	return Add(Mul(normalized, l.gamma.value), l.beta.value).Rows(), normalized, invStd
+}
+
+func (l *LayerNorm) Backward(grads [][]float64) [][]float64 {
+	g := batchTensor(grads, l.size)
+	d := float64(l.size)
+	l.gamma.grad.AddInPlace(Mul(g, l.normalized).Sum(0))
+	l.beta.grad.AddInPlace(g.Sum(0))
+
+	dNormalized := Mul(g, l.gamma.value)
+	sum := dNormalized.Sum(1)
+	dot := Mul(dNormalized, l.normalized).Sum(1)
+	inputGrads := Sub(Sub(dNormalized.Scale(d), sum), Mul(l.normalized, dot))
+	return Mul(inputGrads, l.invStd.Scale(1/d)).Rows()
+}
+
+func (l *LayerNorm) Params() []*Param {
+	return []*Param{l.gamma.Param, l.beta.Param}
+}
+
+func (l *LayerNorm) Replicate() Layer {
+	r := NewLayerNorm(l.size)
+	r.Epsilon = l.Epsilon
+	r.gamma, r.beta = l.gamma.share(), l.beta.share()
+	return r
+}
@@ -0,0 +1,334 @@
+package gonn
+
+import (
+	"fmt"
+	"math"
+)
+
+// Optimizer updates parameters from the gradients accumulated in them.
+// Optimizers keep per-parameter state such as momentum, which can be exported
+// with State and restored with SetState to resume training exactly.
+type Optimizer interface {
+	Step(params []*Param)
+	GetLearningRate() float64
+	// SetLearningRate changes the learning rate used by subsequent steps.
+	SetLearningRate(rate float64)
+	// State returns the state kept for params without changing it, with zero
+	// matrices for parameters that have not been updated yet.
+	State(params []*Param) OptimizerState
+	SetState(params []*Param, state OptimizerState) error
+}
+
+// OptimizerState is the serializable state of an Optimizer. Slots holds, for
+// every parameter in order, the matrices the optimizer keeps for it.
+type OptimizerState struct {
+	Type  string          `json:"type"`
+	Step  int             `json:"step"`
+	Slots [][][][]float64 `json:"slots"`
+}
+
+// slots holds the per-parameter matrices of an optimizer.
+type slots struct {
+	step  int
+	slots map[*Param][][][]float64
+}
+
+// get returns the n slots of p, allocating them with the shape of p on first use.
+func (s *slots) get(p *Param, n int) [][][]float64 {
+	if s.slots == nil {
+		s.slots = map[*Param][][][]float64{}
+	}
+	ss, ok := s.slots[p]
+	if !ok {
+		ss = zeroSlots(p, n)
+		s.slots[p] = ss
+	}
+	return ss
+}
+
+// zeroSlots returns n zero matrices with the shape of p.
+func zeroSlots(p *Param, n int) [][][]float64 {
+	ss := make([][][]float64, n)
+	for i := range ss {
+		ss[i] = zerosLike(p.Value)
+	}
+	return ss
+}
+
+// export returns the state of params. Unlike get, it does not store the zero
+// slots of parameters that have not been updated yet, so that the model only
+// needs to be read-locked while it runs.
+func (s *slots) export(kind string, params []*Param, n int) OptimizerState {
+	state := OptimizerState{Type: kind, Step: s.step, Slots: make([][][][]float64, len(params))}
+	for i, p := range params {
+		ss, ok := s.slots[p]
+		if !ok {
+			ss = zeroSlots(p, n)
+		}
+		state.Slots[i] = ss
+	}
+	return state
+}
+
+func (s *slots) restore(kind string, params []*Param, n int, state OptimizerState) error {
+	if state.Type != kind {
+		return fmt.Errorf("optimizer state type mismatch: want %q, got %q", kind, state.Type)
+	}
+	if len(state.Slots) != len(params) {
+		return fmt.Errorf("optimizer state has %d parameters, model has %d", len(state.Slots), len(params))
+	}
+	restored := map[*Param][][][]float64{}
+	for i, p := range params {
+		if len(state.Slots[i]) != n {
+			return fmt.Errorf("optimizer state parameter %d has %d slots, want %d", i, len(state.Slots[i]), n)
+		}
+		for _, m := range state.Slots[i] {
+			if !sameShape(m, p.Value) {
+				return fmt.Errorf("optimizer state parameter %d does not match the model shape", i)
+			}
+		}
+		restored[p] = state.Slots[i]
+	}
+	s.step = state.Step
+	s.slots = restored
+	return nil
+}
+
+func sameShape(a, b [][]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// SGD is stochastic gradient descent with optional momentum and Nesterov
+// momentum.
+type SGD struct {
+	LearningRate float64
+	Momentum     float64
+	Nesterov     bool
+	state        slots
+}
+
+// NewSGD returns plain stochastic gradient descent.
+func NewSGD(learningRate float64) *SGD {
+	return &SGD{LearningRate: learningRate}
+}
+
+// NewMomentum returns stochastic gradient descent with momentum.
+func NewMomentum(learningRate, momentum float64, nesterov bool) *SGD {
+	return &SGD{LearningRate: learningRate, Momentum: momentum, Nesterov: nesterov}
+}
+
+func (o *SGD) Step(params []*Param) {
+	o.state.step++
+	for _, p := range params {
+		if o.Momentum == 0 {
+			for _, i := range p.rows() {
+				for j := range p.Value[i] {
+					p.Value[i][j] -= o.LearningRate * p.Grad[i][j]
+				}
+			}
+			continue
+		}
+		velocity := o.state.get(p, 1)[0]
+		for _, i := range p.rows() {
+			for j := range p.Value[i] {
+				g := p.Grad[i][j]
+				velocity[i][j] = o.Momentum*velocity[i][j] + g
+				if o.Nesterov {
+					g += o.Momentum * velocity[i][j]
+				} else {
+					g = velocity[i][j]
+				}
+				p.Value[i][j] -= o.LearningRate * g
+			}
+		}
+	}
+}
+
+func (o *SGD) GetLearningRate() float64 {
+	return o.LearningRate
+}
+
+func (o *SGD) SetLearningRate(rate float64) {
+	o.LearningRate = rate
+}
+
+func (o *SGD) State(params []*Param) OptimizerState {
+	return o.state.export("sgd", params, 1)
+}
+
+func (o *SGD) SetState(params []*Param, state OptimizerState) error {
+	return o.state.restore("sgd", params, 1, state)
+}
+
+// RMSProp divides the gradient by a running average of its recent magnitude.
+type RMSProp struct {
+	LearningRate float64
+	Decay        float64
+	Epsilon      float64
+	state        slots
+}
+
+// NewRMSProp returns RMSProp with a decay of 0.9.
+func NewRMSProp(learningRate float64) *RMSProp {
+	return &RMSProp{LearningRate: learningRate, Decay: 0.9, Epsilon: 1e-8}
+}
+
+func (o *RMSProp) Step(params []*Param) {
+	o.state.step++
+	for _, p := range params {
+		average := o.state.get(p, 1)[0]
+		for _, i := range p.rows() {
+			for j := range p.Value[i] {
+				g := p.Grad[i][j]
+				average[i][j] = o.Decay*average[i][j] + (1-o.Decay)*g*g
+				p.Value[i][j] -= o.LearningRate * g / (math.Sqrt(average[i][j]) + o.Epsilon)
+			}
+		}
+	}
+}
+
+func (o *RMSProp) GetLearningRate() float64 {
+	return o.LearningRate
+}
+
+func (o *RMSProp) SetLearningRate(rate float64) {
+	o.LearningRate = rate
+}
+
+func (o *RMSProp) State(params []*Param) OptimizerState {
+	return o.state.export("rmsprop", params, 1)
+}
+
+func (o *RMSProp) SetState(params []*Param, state OptimizerState) error {
+	return o.state.restore("rmsprop", params, 1, state)
+}
+
+// AdaGrad scales the learning rate of every weight by the inverse square root
+// of the sum of its squared gradients.
+type AdaGrad struct {
+	LearningRate float64
+	Epsilon      float64
+	state        slots
+}
+
+// NewAdaGrad returns AdaGrad.
+func NewAdaGrad(learningRate float64) *AdaGrad {
+	return &AdaGrad{LearningRate: learningRate, Epsilon: 1e-8}
+}
+
+func (o *AdaGrad) Step(params []*Param) {
+	o.state.step++
+	for _, p := range params {
+		sum := o.state.get(p, 1)[0]
+		for _, i := range p.rows() {
+			for j := range p.Value[i] {
+				g := p.Grad[i][j]
+				sum[i][j] += g * g
+				p.Value[i][j] -= o.LearningRate * g / (math.Sqrt(sum[i][j]) + o.Epsilon)
+			}
+		}
+	}
+}
+
+func (o *AdaGrad) GetLearningRate() float64 {
+	return o.LearningRate
+}
+
+func (o *AdaGrad) SetLearningRate(rate float64) {
+	o.LearningRate = rate
+}
+
+func (o *AdaGrad) State(params []*Param) OptimizerState {
+	return o.state.export("adagrad", params, 1)
+}
+
+func (o *AdaGrad) SetState(params []*Param, state OptimizerState) error {
+	return o.state.restore("adagrad", params, 1, state)
+}
+
+// Adam keeps bias-corrected running averages of the gradient and its square.
+type Adam struct {
+	LearningRate float64
+	Beta1        float64
+	Beta2        float64
+	Epsilon      float64
+	state        slots
+}
+
+// NewAdam returns Adam with the usual defaults of beta1 = 0.9 and
+// beta2 = 0.999.
+func NewAdam(learningRate float64) *Adam {
+	return &Adam{LearningRate: learningRate, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}
+}
+
+func (o *Adam) Step(params []*Param) {
+	o.step(params, 0)
+}
+
+// step applies one Adam update. A non-zero weightDecay is applied directly to
+// the weights as in AdamW.
+func (o *Adam) step(params []*Param, weightDecay float64) {
+	o.state.step++
+	correction1 := 1 - math.Pow(o.Beta1, float64(o.state.step))
+	correction2 := 1 - math.Pow(o.Beta2, float64(o.state.step))
+	for _, p := range params {
+		s := o.state.get(p, 2)
+		m, v := s[0], s[1]
+		for _, i := range p.rows() {
+			for j := range p.Value[i] {
+				g := p.Grad[i][j]
+				m[i][j] = o.Beta1*m[i][j] + (1-o.Beta1)*g
+				v[i][j] = o.Beta2*v[i][j] + (1-o.Beta2)*g*g
+				update := (m[i][j] / correction1) / (math.Sqrt(v[i][j]/correction2) + o.Epsilon)
+				p.Value[i][j] -= o.LearningRate * (update + weightDecay*p.Value[i][j])
+			}
+		}
+	}
+}
+
+func (o *Adam) GetLearningRate() float64 {
+	return o.LearningRate
+}
+
+func (o *Adam) SetLearningRate(rate float64) {
+	o.LearningRate = rate
+}
+
+func (o *Adam) State(params []*Param) OptimizerState {
+	return o.state.export("adam", params, 2)
+}
+
+func (o *Adam) SetState(params []*Param, state OptimizerState) error {
+	return o.state.restore("adam", params, 2, state)
+}
+
+// AdamW is Adam with weight decay decoupled from the gradient.
+type AdamW struct {
+	Adam
+	WeightDecay float64
+}
+
+// NewAdamW returns AdamW with the Adam defaults.
+func NewAdamW(learningRate, weightDecay float64) *AdamW {
+	return &AdamW{Adam: *NewAdam(learningRate), WeightDecay: weightDecay}
+}
+
+func (o *AdamW) Step(params []*Param) {
+	o.step(params, o.WeightDecay)
+}
+
+func (o *AdamW) State(params []*Param) OptimizerState {
+	return o.state.export("adamw", params, 2)
+}
+
+func (o *AdamW) SetState(params []*Param, state OptimizerState) error {
+	return o.state.restore("adamw", params, 2, state)
+}
@@ -0,0 +1,144 @@
+package gonn
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// SequentialWeights is the serialized form of the parameters of a Sequential
+// model, in the order returned by Params. The layers themselves are not
+// saved; weights are loaded into a model built with the same layers.
+type SequentialWeights struct {
+	Params [][][]float64 `json:"params"`
+	// Buffers holds the state of layers implementing Buffered in order.
+	Buffers [][][]float64 `json:"buffers,omitempty"`
+}
+
+func (s *Sequential) weights() SequentialWeights {
+	weights := SequentialWeights{Buffers: s.Buffers()}
+	for _, p := range s.Params() {
+		weights.Params = append(weights.Params, p.Value)
+	}
+	return weights
+}
+
+func (s *Sequential) setWeights(weights SequentialWeights) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	params := s.Params()
+	if len(weights.Params) != len(params) {
+		return fmt.Errorf("weights have %d parameters, model has %d", len(weights.Params), len(params))
+	}
+	for i, p := range params {
+		if !sameShape(weights.Params[i], p.Value) {
+			return fmt.Errorf("weights parameter %d does not match the model shape", i)
+		}
+	}
+	buffers := s.Buffers()
+	if len(weights.Buffers) != len(buffers) {
+		return fmt.Errorf("weights have %d buffers, model has %d", len(weights.Buffers), len(buffers))
+	}
+	for i, b := range buffers {
+		if !sameShape(weights.Buffers[i], b) {
+			return fmt.Errorf("weights buffer %d does not match the model shape", i)
+		}
+	}
+	for i, p := range params {
+		for j := range p.Value {
+			copy(p.Value[j], weights.Params[i][j])
+		}
+	}
+	for i, b := range buffers {
+		for j := range b {
+			copy(b[j], weights.Buffers[i][j])
+		}
+	}
+	return nil
+}
+
+func (s *Sequential) SaveWeights(filepath string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return saveJSON(filepath, s.weights())
+}
+
+func (s *Sequential) LoadWeights(filepath string) error {
+	weights := SequentialWeights{}
+	if err := loadJSON(filepath, &weights); err != nil {
+		return err
+	}
+	return s.setWeights(weights)
+}
+
+func (s *Sequential) SaveWeightsBinary(filepath string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return saveGob(filepath, s.weights())
+}
+
+func (s *Sequential) LoadWeightsBinary(filepath string) error {
+	weights := SequentialWeights{}
+	if err := loadGob(filepath, &weights); err != nil {
+		return err
+	}
+	return s.setWeights(weights)
+}
+
+// SaveOptimizerState saves the state optimizer keeps for the parameters of
+// the model so that training can be resumed exactly with LoadOptimizerState.
+func (s *Sequential) SaveOptimizerState(filepath string, optimizer Optimizer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return saveJSON(filepath, optimizer.State(s.Params()))
+}
+
+// LoadOptimizerState restores the optimizer state saved by SaveOptimizerState.
+func (s *Sequential) LoadOptimizerState(filepath string, optimizer Optimizer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state := OptimizerState{}
+	if err := loadJSON(filepath, &state); err != nil {
+		return err
+	}
+	return optimizer.SetState(s.Params(), state)
+}
+
+func saveJSON(filepath string, v interface{}) error {
+	file, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(v)
+}
+
+func loadJSON(filepath string, v interface{}) error {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func saveGob(filepath string, v interface{}) error {
+	file, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return gob.NewEncoder(file).Encode(v)
+}
+
+func loadGob(filepath string, v interface{}) error {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
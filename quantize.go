@@ -0,0 +1,305 @@
+package gonn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// QuantizedNetwork is a NeuralNetwork whose weights are stored as int8 for
+// inference. Every output unit of a layer has its own weight scale and zero
+// point, and the inputs of every layer are quantized with a scale and zero
+// point calibrated on sample inputs, so that the matrix products run on
+// integers. Create one with Quantize. Its methods are safe for concurrent use.
+type QuantizedNetwork struct {
+	// mu guards the layers and activations, which loading replaces.
+	mu          sync.RWMutex
+	layers      []QuantizedLayer
+	activations []Activation
+}
+
+// QuantizedWeights is the serialized form of a QuantizedNetwork. Activations
+// holds the registered names of the activations of the layers; it is empty
+// when an activation has not been registered.
+type QuantizedWeights struct {
+	Layers      []QuantizedLayer
+	Activations []string
+}
+
+// QuantizedLayer holds a quantized fully connected layer. A weight is
+// Scales[c] * (Weights[j*OutputSize+c] - ZeroPoints[c]) and an input is
+// InputScale * (q - InputZeroPoint). Bias is quantized with the scale
+// InputScale * Scales[c] and no zero point.
+type QuantizedLayer struct {
+	InputSize      int
+	OutputSize     int
+	Weights        []int8
+	Scales         []float64
+	ZeroPoints     []int8
+	Bias           []int32
+	InputScale     float64
+	InputZeroPoint int8
+}
+
+// Quantize converts nn to int8 after training. calibrationInputs are typical
+// inputs used to choose the quantization range of the input of every layer.
+func Quantize(nn *NeuralNetwork, calibrationInputs [][]float64) (*QuantizedNetwork, error) {
+	if len(calibrationInputs) == 0 {
+		return nil, errors.New("no calibration inputs")
+	}
+	s := nn.sequential()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hidden, output := nn.layers()
+	q := &QuantizedNetwork{activations: []Activation{hidden.activation, output.activation}}
+	inputs := calibrationInputs
+	for _, d := range []*Dense{hidden, output} {
+		q.layers = append(q.layers, quantizeDense(d, inputs))
+		inputs = d.Predict(inputs)
+	}
+	return q, nil
+}
+
+func quantizeDense(d *Dense, inputs [][]float64) QuantizedLayer {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, input := range inputs {
+		for _, x := range input {
+			min = math.Min(min, x)
+			max = math.Max(max, x)
+		}
+	}
+	l := QuantizedLayer{
+		InputSize:  d.inputSize,
+		OutputSize: d.outputSize,
+		Weights:    make([]int8, d.inputSize*d.outputSize),
+		Scales:     make([]float64, d.outputSize),
+		ZeroPoints: make([]int8, d.outputSize),
+		Bias:       make([]int32, d.outputSize),
+	}
+	l.InputScale, l.InputZeroPoint = quantizationParams(min, max)
+
+	// 出力ユニット (重みの列) ごとにスケールとゼロ点を決める
+	weights := d.weights.Value
+	for c := 0; c < d.outputSize; c++ {
+		min, max := math.Inf(1), math.Inf(-1)
+		for j := range weights {
+			min = math.Min(min, weights[j][c])
+			max = math.Max(max, weights[j][c])
+		}
+		l.Scales[c], l.ZeroPoints[c] = quantizationParams(min, max)
+		for j := range weights {
+			l.Weights[j*d.outputSize+c] = quantize(weights[j][c], l.Scales[c], l.ZeroPoints[c])
+		}
+		l.Bias[c] = clampInt32(math.Round(d.bias.Value[0][c] / (l.InputScale * l.Scales[c])))
+	}
+	return l
+}
+
+// quantizationParams returns the scale and zero point mapping [min, max],
+// widened to contain 0 so that zero is exact, onto [-128, 127].
+func quantizationParams(min, max float64) (float64, int8) {
+	min = math.Min(min, 0)
+	max = math.Max(max, 0)
+	if max == min {
+		return 1, 0
+	}
+	scale := (max - min) / 255
+	return scale, clampInt8(math.Round(-128 - min/scale))
+}
+
+func quantize(v, scale float64, zeroPoint int8) int8 {
+	return clampInt8(math.Round(v/scale) + float64(zeroPoint))
+}
+
+func clampInt8(v float64) int8 {
+	return int8(math.Max(-128, math.Min(127, v)))
+}
+
+func clampInt32(v float64) int32 {
+	return int32(math.Max(math.MinInt32, math.Min(math.MaxInt32, v)))
+}
+
+// SetActivationFunction sets the activations of the hidden and output layers
+// from a "hidden-output" pair of registered names such as "relu-sigmoid".
+func (q *QuantizedNetwork) SetActivationFunction(activationFunction string) error {
+	hiddenActivation, outputActivation, err := splitActivations(activationFunction)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.activations = []Activation{hiddenActivation, outputActivation}
+	return nil
+}
+
+// Forward returns the output of the network for input. The matrix products
+// are computed on int8 values with int32 accumulators; activations are applied
+// to the dequantized results.
+func (q *QuantizedNetwork) Forward(input []float64) []float64 {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	for i, l := range q.layers {
+		input = q.activations[i].Apply(l.forward(input))
+	}
+	return input
+}
+
+func (l *QuantizedLayer) forward(input []float64) []float64 {
+	acc := make([]int32, l.OutputSize)
+	copy(acc, l.Bias)
+	zeroPoints := make([]int32, l.OutputSize)
+	for c, z := range l.ZeroPoints {
+		zeroPoints[c] = int32(z)
+	}
+	for j, x := range input {
+		dx := int32(quantize(x, l.InputScale, l.InputZeroPoint)) - int32(l.InputZeroPoint)
+		if dx == 0 {
+			continue
+		}
+		for c, w := range l.Weights[j*l.OutputSize : (j+1)*l.OutputSize] {
+			acc[c] += dx * (int32(w) - zeroPoints[c])
+		}
+	}
+	z := make([]float64, l.OutputSize)
+	for c := range z {
+		z[c] = float64(acc[c]) * l.InputScale * l.Scales[c]
+	}
+	return z
+}
+
+// SaveWeightsBinary saves the layers and the names of the activations. The
+// activations are not saved if one of them has not been registered.
+func (q *QuantizedNetwork) SaveWeightsBinary(filepath string) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	weights := QuantizedWeights{Layers: q.layers}
+	for _, a := range q.activations {
+		name, ok := activationName(a)
+		if !ok {
+			weights.Activations = nil
+			break
+		}
+		weights.Activations = append(weights.Activations, name)
+	}
+	return saveGob(filepath, weights)
+}
+
+// LoadWeightsBinary loads weights saved by SaveWeightsBinary. When the file
+// has no activations, those set with SetActivationFunction are kept, and an
+// error is returned if none have been set.
+func (q *QuantizedNetwork) LoadWeightsBinary(filepath string) error {
+	weights := QuantizedWeights{}
+	if err := loadGob(filepath, &weights); err != nil {
+		return err
+	}
+	if err := weights.check(); err != nil {
+		return err
+	}
+	var activations []Activation
+	for _, name := range weights.Activations {
+		a, err := GetActivation(name)
+		if err != nil {
+			return err
+		}
+		activations = append(activations, a)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if activations == nil {
+		if len(q.activations) != len(weights.Layers) {
+			return errors.New("quantized weights have no activations; set them with SetActivationFunction before loading")
+		}
+		activations = q.activations
+	}
+	q.layers = weights.Layers
+	q.activations = activations
+	return nil
+}
+
+// check returns an error unless the weights hold a hidden and an output layer
+// of consistent sizes.
+func (w QuantizedWeights) check() error {
+	if len(w.Layers) != 2 {
+		return fmt.Errorf("quantized weights have %d layers, want 2", len(w.Layers))
+	}
+	if len(w.Activations) != 0 && len(w.Activations) != len(w.Layers) {
+		return fmt.Errorf("quantized weights have %d activations for %d layers", len(w.Activations), len(w.Layers))
+	}
+	for i, l := range w.Layers {
+		if len(l.Weights) != l.InputSize*l.OutputSize || len(l.Scales) != l.OutputSize ||
+			len(l.ZeroPoints) != l.OutputSize || len(l.Bias) != l.OutputSize {
+			return fmt.Errorf("quantized layer %d does not match its sizes", i)
+		}
+		if i > 0 && l.InputSize != w.Layers[i-1].OutputSize {
+			return fmt.Errorf("quantized layer %d takes %d inputs, layer %d has %d outputs", i, l.InputSize, i-1, w.Layers[i-1].OutputSize)
+		}
+	}
+	return nil
+}
+
+// QuantizationReport compares the outputs of a quantized network with those
+// of the float network it was made from.
+type QuantizationReport struct {
+	Samples int
+	// MaxAbsError and MeanAbsError are taken over every output value.
+	MaxAbsError  float64
+	MeanAbsError float64
+	// Agreement is the percentage of samples whose largest output is the same
+	// in both networks.
+	Agreement float64
+	// FloatAccuracy and QuantizedAccuracy are the percentages of samples whose
+	// largest output matches a target of 1. They are set when targets are
+	// given.
+	HasAccuracy       bool
+	FloatAccuracy     float64
+	QuantizedAccuracy float64
+}
+
+// CompareQuantized runs nn and q on inputs and reports how much they differ.
+// outputs may be nil; when given, the accuracy of both networks is reported.
+func CompareQuantized(nn *NeuralNetwork, q *QuantizedNetwork, inputs, outputs [][]float64) QuantizationReport {
+	report := QuantizationReport{Samples: len(inputs), HasAccuracy: outputs != nil}
+	if len(inputs) == 0 {
+		return report
+	}
+	values := 0
+	agree, floatCorrect, quantizedCorrect := 0, 0, 0
+	for n, input := range inputs {
+		expected := nn.Forward(input)
+		actual := q.Forward(input)
+		for i := range expected {
+			e := math.Abs(expected[i] - actual[i])
+			report.MaxAbsError = math.Max(report.MaxAbsError, e)
+			report.MeanAbsError += e
+			values++
+		}
+		if argmax(expected) == argmax(actual) {
+			agree++
+		}
+		if outputs != nil {
+			if outputs[n][argmax(expected)] == 1 {
+				floatCorrect++
+			}
+			if outputs[n][argmax(actual)] == 1 {
+				quantizedCorrect++
+			}
+		}
+	}
+	samples := float64(len(inputs))
+	report.MeanAbsError /= float64(values)
+	report.Agreement = float64(agree) / samples * 100
+	report.FloatAccuracy = float64(floatCorrect) / samples * 100
+	report.QuantizedAccuracy = float64(quantizedCorrect) / samples * 100
+	return report
+}
+
+func (r QuantizationReport) String() string {
+	s := fmt.Sprintf("samples: %d, max abs error: %f, mean abs error: %f, agreement: %f",
+		r.Samples, r.MaxAbsError, r.MeanAbsError, r.Agreement)
+	if r.HasAccuracy {
+		s += fmt.Sprintf(", float accuracy: %f, quantized accuracy: %f", r.FloatAccuracy, r.QuantizedAccuracy)
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package gonn
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestQuantizeAccuracy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	inputs, outputs := classification(rng, 200, 8, 4)
+	nn := NewNeuralNetworkRand(8, 16, 4, "relu-softmax", rng)
+	fit(t, nn.Sequential, inputs, outputs, 16, 1)
+
+	q, err := Quantize(nn, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := CompareQuantized(nn, q, inputs, outputs)
+	if report.Samples != len(inputs) || !report.HasAccuracy {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.MaxAbsError > 0.05 || report.MeanAbsError > report.MaxAbsError {
+		t.Errorf("errors: max %g, mean %g", report.MaxAbsError, report.MeanAbsError)
+	}
+	if report.Agreement < 95 {
+		t.Errorf("agreement = %g%%, want at least 95%%", report.Agreement)
+	}
+	if math.Abs(report.FloatAccuracy-report.QuantizedAccuracy) > 5 {
+		t.Errorf("float accuracy %g%%, quantized accuracy %g%%", report.FloatAccuracy, report.QuantizedAccuracy)
+	}
+
+	if report := CompareQuantized(nn, q, inputs, nil); report.HasAccuracy || report.FloatAccuracy != 0 {
+		t.Errorf("report without outputs = %+v", report)
+	}
+}
+
+func TestQuantizeClampsBias(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	nn := NewNeuralNetworkRand(2, 2, 2, "relu-sigmoid", rng)
+	hidden, _ := nn.layers()
+	hidden.bias.Value[0][0] = 1e12
+	hidden.bias.Value[0][1] = -1e12
+
+	q, err := Quantize(nn, randomInputs(rng, 4, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.layers[0].Bias; got[0] != math.MaxInt32 || got[1] != math.MinInt32 {
+		t.Errorf("bias = %v, want [%d %d]", got, math.MaxInt32, math.MinInt32)
+	}
+}
+
+func TestQuantizedNetworkSaveLoad(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	inputs := randomInputs(rng, 20, 5)
+	q, err := Quantize(NewNeuralNetworkRand(5, 4, 3, "tanh-softmax", rng), inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "q.gob")
+	if err := q.SaveWeightsBinary(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &QuantizedNetwork{}
+	if err := loaded.LoadWeightsBinary(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.layers, q.layers) {
+		t.Error("loaded layers differ from the saved ones")
+	}
+	for _, input := range inputs {
+		if got, want := loaded.Forward(input), q.Forward(input); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Forward = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestQuantizedNetworkLoadWithoutActivations(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	q, err := Quantize(NewNeuralNetworkRand(5, 4, 3, "relu-sigmoid", rng), randomInputs(rng, 4, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "q.gob")
+	if err := saveGob(path, QuantizedWeights{Layers: q.layers}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&QuantizedNetwork{}).LoadWeightsBinary(path); err == nil {
+		t.Error("LoadWeightsBinary without activations returned no error")
+	}
+	loaded := &QuantizedNetwork{}
+	if err := loaded.SetActivationFunction("relu-sigmoid"); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.LoadWeightsBinary(path); err != nil {
+		t.Fatal(err)
+	}
+	input := []float64{1, 2, 3, 4, 5}
+	if got, want := loaded.Forward(input), q.Forward(input); !reflect.DeepEqual(got, want) {
+		t.Errorf("Forward = %v, want %v", got, want)
+	}
+}
+
+func TestQuantizedNetworkLoadRejectsInvalidLayers(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	q, err := Quantize(NewNeuralNetworkRand(5, 4, 3, "relu-sigmoid", rng), randomInputs(rng, 4, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Quantize(NewNeuralNetworkRand(5, 6, 3, "relu-sigmoid", rng), randomInputs(rng, 4, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := q.layers[1]
+	short.Bias = short.Bias[:2]
+
+	activations := []string{"relu", "sigmoid"}
+	for name, weights := range map[string]QuantizedWeights{
+		"one layer":    {Layers: q.layers[:1], Activations: activations[:1]},
+		"three layers": {Layers: append(q.layers, q.layers[1]), Activations: append(activations, "sigmoid")},
+		"chaining":     {Layers: []QuantizedLayer{q.layers[0], other.layers[1]}, Activations: activations},
+		"sizes":        {Layers: []QuantizedLayer{q.layers[0], short}, Activations: activations},
+		"activations":  {Layers: q.layers, Activations: activations[:1]},
+		"unknown":      {Layers: q.layers, Activations: []string{"relu", "unknown"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "q.gob")
+			if err := saveGob(path, weights); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.LoadWeightsBinary(path); err == nil {
+				t.Error("LoadWeightsBinary returned no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package gonn
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedSource makes a rand.Source safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// defaultRand is used when no *rand.Rand is given. It is seeded once with the
+// current time and never touches the global source of math/rand.
+var defaultRand = rand.New(&lockedSource{
+	src: rand.NewSource(time.Now().UnixNano()).(rand.Source64),
+})
+
+func randOrDefault(rng *rand.Rand) *rand.Rand {
+	if rng == nil {
+		return defaultRand
+	}
+	return rng
+}
@@ -0,0 +1,379 @@
+package gonn
+
+import (
+	"math"
+	"math/rand"
+)
+
+// RecurrentOptions configures a recurrent layer.
+type RecurrentOptions struct {
+	// ReturnSequences makes the layer output the hidden state of every time
+	// step instead of only the last one.
+	ReturnSequences bool
+	// TruncateBPTT splits sequences into chunks of that many time steps and
+	// stops gradients from flowing back from one chunk into the previous one.
+	// The hidden state is still carried across chunks. Zero backpropagates
+	// through the whole sequence.
+	TruncateBPTT int
+}
+
+// recurrentCell computes one time step of a recurrent layer. ax and ah are the
+// input and hidden state multiplied by their weights, with the bias added to
+// ax. The first hiddenSize values of a state are the hidden state.
+type recurrentCell interface {
+	gates() int
+	stateSize(hiddenSize int) int
+	step(ax, ah, state []float64) ([]float64, interface{})
+	// backStep returns the gradients of ax and ah and the part of the gradient
+	// of the previous state that does not flow through ah.
+	backStep(cache interface{}, grad []float64) ([]float64, []float64, []float64)
+}
+
+// Recurrent is a recurrent layer trained with backpropagation through time.
+// Every sample is a sequence stored flat, time step after time step, with
+// inputSize values per step; sequences may have different lengths. The layer
+// outputs hiddenSize values, or hiddenSize values per step when
+// ReturnSequences is set.
+type Recurrent struct {
+	inputSize  int
+	hiddenSize int
+	options    RecurrentOptions
+	cell       recurrentCell
+	// inputWeights and hiddenWeights hold the weights of every gate side by
+	// side.
+	inputWeights, hiddenWeights, bias tensorParam
+
+	steps [][]recurrentStep
+}
+
+type recurrentStep struct {
+	input  []float64
+	hidden []float64
+	cache  interface{}
+}
+
+// NewSimpleRNN returns a recurrent layer computing h = tanh(x Wx + h Wh + b).
+func NewSimpleRNN(inputSize, hiddenSize int, options RecurrentOptions) *Recurrent {
+	return NewSimpleRNNRand(inputSize, hiddenSize, options, nil)
+}
+
+// NewSimpleRNNRand is like NewSimpleRNN but draws the initial weights from
+// rng. A nil rng uses a shared source seeded with the current time.
+func NewSimpleRNNRand(inputSize, hiddenSize int, options RecurrentOptions, rng *rand.Rand) *Recurrent {
+	return newRecurrent(inputSize, hiddenSize, options, simpleRNNCell{}, rng)
+}
+
+// NewLSTM returns a long short-term memory layer. The biases of the forget
+// gate start at 1.
+func NewLSTM(inputSize, hiddenSize int, options RecurrentOptions) *Recurrent {
+	return NewLSTMRand(inputSize, hiddenSize, options, nil)
+}
+
+// NewLSTMRand is like NewLSTM but draws the initial weights from rng. A nil
+// rng uses a shared source seeded with the current time.
+func NewLSTMRand(inputSize, hiddenSize int, options RecurrentOptions, rng *rand.Rand) *Recurrent {
+	r := newRecurrent(inputSize, hiddenSize, options, lstmCell{hiddenSize}, rng)
+	for i := hiddenSize; i < 2*hiddenSize; i++ {
+		r.bias.value.Data[i] = 1
+	}
+	return r
+}
+
+// NewGRU returns a gated recurrent unit layer. The reset gate is applied after
+// the hidden state is multiplied by its weights.
+func NewGRU(inputSize, hiddenSize int, options RecurrentOptions) *Recurrent {
+	return NewGRURand(inputSize, hiddenSize, options, nil)
+}
+
+// NewGRURand is like NewGRU but draws the initial weights from rng. A nil rng
+// uses a shared source seeded with the current time.
+func NewGRURand(inputSize, hiddenSize int, options RecurrentOptions, rng *rand.Rand) *Recurrent {
+	return newRecurrent(inputSize, hiddenSize, options, gruCell{hiddenSize}, rng)
+}
+
+func newRecurrent(inputSize, hiddenSize int, options RecurrentOptions, cell recurrentCell, rng *rand.Rand) *Recurrent {
+	rng = randOrDefault(rng)
+	size := cell.gates() * hiddenSize
+	r := &Recurrent{
+		inputSize:     inputSize,
+		hiddenSize:    hiddenSize,
+		options:       options,
+		cell:          cell,
+		inputWeights:  newTensorParam(inputSize, size),
+		hiddenWeights: newTensorParam(hiddenSize, size),
+		bias:          newTensorParam(1, size),
+	}
+	XavierUniform(r.inputWeights.Value, inputSize, size, rng)
+	Orthogonal(r.hiddenWeights.Value, hiddenSize, size, rng)
+	return r
+}
+
+func (r *Recurrent) Replicate() Layer {
+	c := *r
+	c.inputWeights = r.inputWeights.share()
+	c.hiddenWeights = r.hiddenWeights.share()
+	c.bias = r.bias.share()
+	c.steps = nil
+	return &c
+}
+
+func (r *Recurrent) Forward(inputs [][]float64) [][]float64 {
+	outputs, steps := r.forward(inputs)
+	r.steps = steps
+	return outputs
+}
+
+func (r *Recurrent) Predict(inputs [][]float64) [][]float64 {
+	outputs, _ := r.forward(inputs)
+	return outputs
+}
+
+func (r *Recurrent) forward(inputs [][]float64) ([][]float64, [][]recurrentStep) {
+	outputs := make([][]float64, len(inputs))
+	steps := make([][]recurrentStep, len(inputs))
+	for n, sequence := range inputs {
+		state := make([]float64, r.cell.stateSize(r.hiddenSize))
+		length := len(sequence) / r.inputSize
+		output := []float64{}
+		steps[n] = make([]recurrentStep, length)
+		for t := 0; t < length; t++ {
+			input := sequence[t*r.inputSize : (t+1)*r.inputSize]
+			hidden := state[:r.hiddenSize]
+			ax := append([]float64(nil), r.bias.value.Data...)
+			ah := make([]float64, len(ax))
+			vecMatAdd(ax, input, r.inputWeights.value)
+			vecMatAdd(ah, hidden, r.hiddenWeights.value)
+
+			next, cache := r.cell.step(ax, ah, state)
+			steps[n][t] = recurrentStep{input: input, hidden: hidden, cache: cache}
+			state = next
+			if r.options.ReturnSequences {
+				output = append(output, state[:r.hiddenSize]...)
+			}
+		}
+		if !r.options.ReturnSequences {
+			output = append(output, state[:r.hiddenSize]...)
+		}
+		outputs[n] = output
+	}
+	return outputs, steps
+}
+
+func (r *Recurrent) Backward(grads [][]float64) [][]float64 {
+	inputGrads := make([][]float64, len(grads))
+	for n, grad := range grads {
+		steps := r.steps[n]
+		length := len(steps)
+		inputGrad := make([]float64, length*r.inputSize)
+		stateGrad := make([]float64, r.cell.stateSize(r.hiddenSize))
+		for t := length - 1; t >= 0; t-- {
+			if r.options.ReturnSequences {
+				addTo(stateGrad[:r.hiddenSize], grad[t*r.hiddenSize:(t+1)*r.hiddenSize])
+			} else if t == length-1 {
+				addTo(stateGrad[:r.hiddenSize], grad)
+			}
+
+			step := steps[t]
+			dax, dah, prevGrad := r.cell.backStep(step.cache, stateGrad)
+			outerAdd(r.inputWeights.grad, step.input, dax)
+			outerAdd(r.hiddenWeights.grad, step.hidden, dah)
+			addTo(r.bias.grad.Data, dax)
+			matVecAdd(inputGrad[t*r.inputSize:(t+1)*r.inputSize], r.inputWeights.value, dax)
+			matVecAdd(prevGrad[:r.hiddenSize], r.hiddenWeights.value, dah)
+			stateGrad = prevGrad
+
+			// 打ち切り BPTT: チャンクの境界より前には勾配を流さない
+			if k := r.options.TruncateBPTT; k > 0 && t%k == 0 {
+				stateGrad = make([]float64, len(stateGrad))
+			}
+		}
+		inputGrads[n] = inputGrad
+	}
+	return inputGrads
+}
+
+func (r *Recurrent) Params() []*Param {
+	return []*Param{r.inputWeights.Param, r.hiddenWeights.Param, r.bias.Param}
+}
+
+// vecMatAdd adds the row vector x multiplied by the contiguous matrix w to dst.
+func vecMatAdd(dst, x []float64, w *Tensor) {
+	cols := w.Shape[1]
+	for j, v := range x {
+		for i, weight := range w.Data[j*cols : (j+1)*cols] {
+			dst[i] += v * weight
+		}
+	}
+}
+
+// matVecAdd adds the contiguous matrix w multiplied by the column vector d to
+// dst.
+func matVecAdd(dst []float64, w *Tensor, d []float64) {
+	cols := w.Shape[1]
+	for j := range dst {
+		for i, weight := range w.Data[j*cols : (j+1)*cols] {
+			dst[j] += weight * d[i]
+		}
+	}
+}
+
+// outerAdd adds the outer product of x and d to the contiguous matrix grad.
+func outerAdd(grad *Tensor, x, d []float64) {
+	cols := grad.Shape[1]
+	for j, v := range x {
+		row := grad.Data[j*cols : (j+1)*cols]
+		for i := range d {
+			row[i] += v * d[i]
+		}
+	}
+}
+
+func addTo(dst, src []float64) {
+	for i := range src {
+		dst[i] += src[i]
+	}
+}
+
+type simpleRNNCell struct{}
+
+func (simpleRNNCell) gates() int {
+	return 1
+}
+
+func (simpleRNNCell) stateSize(hiddenSize int) int {
+	return hiddenSize
+}
+
+func (simpleRNNCell) step(ax, ah, state []float64) ([]float64, interface{}) {
+	next := make([]float64, len(ax))
+	for i := range next {
+		next[i] = math.Tanh(ax[i] + ah[i])
+	}
+	return next, next
+}
+
+func (simpleRNNCell) backStep(cache interface{}, grad []float64) ([]float64, []float64, []float64) {
+	h := cache.([]float64)
+	dz := make([]float64, len(h))
+	for i := range dz {
+		dz[i] = grad[i] * (1 - h[i]*h[i])
+	}
+	return dz, dz, make([]float64, len(h))
+}
+
+// lstmCell keeps the hidden state followed by the cell state. Its gates are
+// the input, forget, candidate and output gates in that order.
+type lstmCell struct {
+	hiddenSize int
+}
+
+type lstmCache struct {
+	i, f, g, o []float64
+	prevCell   []float64
+	cellTanh   []float64
+}
+
+func (lstmCell) gates() int {
+	return 4
+}
+
+func (lstmCell) stateSize(hiddenSize int) int {
+	return 2 * hiddenSize
+}
+
+func (l lstmCell) step(ax, ah, state []float64) ([]float64, interface{}) {
+	h := l.hiddenSize
+	c := lstmCache{
+		i:        make([]float64, h),
+		f:        make([]float64, h),
+		g:        make([]float64, h),
+		o:        make([]float64, h),
+		prevCell: state[h:],
+		cellTanh: make([]float64, h),
+	}
+	next := make([]float64, 2*h)
+	for k := 0; k < h; k++ {
+		c.i[k] = sigmoid(ax[k] + ah[k])
+		c.f[k] = sigmoid(ax[h+k] + ah[h+k])
+		c.g[k] = math.Tanh(ax[2*h+k] + ah[2*h+k])
+		c.o[k] = sigmoid(ax[3*h+k] + ah[3*h+k])
+		next[h+k] = c.f[k]*c.prevCell[k] + c.i[k]*c.g[k]
+		c.cellTanh[k] = math.Tanh(next[h+k])
+		next[k] = c.o[k] * c.cellTanh[k]
+	}
+	return next, c
+}
+
+func (l lstmCell) backStep(cache interface{}, grad []float64) ([]float64, []float64, []float64) {
+	h := l.hiddenSize
+	c := cache.(lstmCache)
+	dz := make([]float64, 4*h)
+	prevGrad := make([]float64, 2*h)
+	for k := 0; k < h; k++ {
+		dh := grad[k]
+		dc := grad[h+k] + dh*c.o[k]*(1-c.cellTanh[k]*c.cellTanh[k])
+		dz[k] = dc * c.g[k] * c.i[k] * (1 - c.i[k])
+		dz[h+k] = dc * c.prevCell[k] * c.f[k] * (1 - c.f[k])
+		dz[2*h+k] = dc * c.i[k] * (1 - c.g[k]*c.g[k])
+		dz[3*h+k] = dh * c.cellTanh[k] * c.o[k] * (1 - c.o[k])
+		prevGrad[h+k] = dc * c.f[k]
+	}
+	return dz, dz, prevGrad
+}
+
+// gruCell has the reset, update and candidate gates in that order.
+type gruCell struct {
+	hiddenSize int
+}
+
+type gruCache struct {
+	r, u, n    []float64
+	prevHidden []float64
+	candidate  []float64
+}
+
+func (gruCell) gates() int {
+	return 3
+}
+
+func (gruCell) stateSize(hiddenSize int) int {
+	return hiddenSize
+}
+
+func (g gruCell) step(ax, ah, state []float64) ([]float64, interface{}) {
+	h := g.hiddenSize
+	c := gruCache{
+		r:          make([]float64, h),
+		u:          make([]float64, h),
+		n:          make([]float64, h),
+		prevHidden: state,
+		candidate:  ah[2*h:],
+	}
+	next := make([]float64, h)
+	for k := 0; k < h; k++ {
+		c.r[k] = sigmoid(ax[k] + ah[k])
+		c.u[k] = sigmoid(ax[h+k] + ah[h+k])
+		c.n[k] = math.Tanh(ax[2*h+k] + c.r[k]*ah[2*h+k])
+		next[k] = (1-c.u[k])*c.n[k] + c.u[k]*state[k]
+	}
+	return next, c
+}
+
+func (g gruCell) backStep(cache interface{}, grad []float64) ([]float64, []float64, []float64) {
+	h := g.hiddenSize
+	c := cache.(gruCache)
+	dax := make([]float64, 3*h)
+	dah := make([]float64, 3*h)
+	prevGrad := make([]float64, h)
+	for k := 0; k < h; k++ {
+		dn := grad[k] * (1 - c.u[k]) * (1 - c.n[k]*c.n[k])
+		dr := dn * c.candidate[k] * c.r[k] * (1 - c.r[k])
+		du := grad[k] * (c.prevHidden[k] - c.n[k]) * c.u[k] * (1 - c.u[k])
+		dax[k], dah[k] = dr, dr
+		dax[h+k], dah[h+k] = du, du
+		dax[2*h+k] = dn
+		dah[2*h+k] = dn * c.r[k]
+		prevGrad[k] = grad[k] * c.u[k]
+	}
+	return dax, dah, prevGrad
+}
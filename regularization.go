@@ -0,0 +1,83 @@
+package gonn
+
+import (
+	"math"
+)
+
+// penalty returns the L1 and L2 penalty of params and adds its gradient to
+// the accumulated gradients. Like the optimizers, it only covers the rows of
+// sparse parameters that received a gradient, so that the vectors of IDs
+// missing from a batch are not decayed.
+func penalty(params []*Param) float64 {
+	total := 0.0
+	for _, p := range params {
+		if p.L1 == 0 && p.L2 == 0 {
+			continue
+		}
+		for _, i := range p.rows() {
+			for j, w := range p.Value[i] {
+				total += p.L1*math.Abs(w) + p.L2*w*w/2
+				if w > 0 {
+					p.Grad[i][j] += p.L1
+				} else if w < 0 {
+					p.Grad[i][j] -= p.L1
+				}
+				p.Grad[i][j] += p.L2 * w
+			}
+		}
+	}
+	return total
+}
+
+// penaltyValue returns the L1 and L2 penalty of params like penalty, without
+// touching the gradients.
+func penaltyValue(params []*Param) float64 {
+	total := 0.0
+	for _, p := range params {
+		if p.L1 == 0 && p.L2 == 0 {
+			continue
+		}
+		for _, i := range p.rows() {
+			for _, w := range p.Value[i] {
+				total += p.L1*math.Abs(w) + p.L2*w*w/2
+			}
+		}
+	}
+	return total
+}
+
+// clipByValue limits every gradient to [-limit, limit].
+func clipByValue(params []*Param, limit float64) {
+	for _, p := range params {
+		for i := range p.Grad {
+			for j, g := range p.Grad[i] {
+				p.Grad[i][j] = math.Max(-limit, math.Min(limit, g))
+			}
+		}
+	}
+}
+
+// clipByGlobalNorm rescales all gradients together so that their combined L2
+// norm does not exceed limit.
+func clipByGlobalNorm(params []*Param, limit float64) {
+	sum := 0.0
+	for _, p := range params {
+		for i := range p.Grad {
+			for _, g := range p.Grad[i] {
+				sum += g * g
+			}
+		}
+	}
+	norm := math.Sqrt(sum)
+	if norm <= limit {
+		return
+	}
+	scale := limit / norm
+	for _, p := range params {
+		for i := range p.Grad {
+			for j := range p.Grad[i] {
+				p.Grad[i][j] *= scale
+			}
+		}
+	}
+}
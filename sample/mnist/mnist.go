@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
@@ -73,8 +74,22 @@ func main() {
 	}
 
 	// Train neural network
-	nn := NewNeuralNetwork(len(inputs[0]), 64, len(labels[0]), "relu-sigmoid")
-	nn.TrainNeuralNetwork(inputs, outputs, 0.01, 50)
+	nn := NewNeuralNetwork(len(inputs[0]), 64, len(labels[0]), "relu-softmax")
+	_, err = nn.Fit(inputs, outputs, TrainConfig{
+		Epochs:    50,
+		Optimizer: NewAdam(0.001),
+		BatchSize: 32,
+		Shuffle:   true,
+		Rand:      rand.New(rand.NewSource(1)),
+
+		// 学習データの1割で検証し、5エポック改善しなければ最良の重みに戻して終了する
+		ValidationSplit:    0.1,
+		Patience:           5,
+		RestoreBestWeights: true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Save weights
 	nn.SaveWeights("weights.json")
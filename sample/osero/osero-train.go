@@ -1,3 +1,6 @@
+//go:build ignore
+// +build ignore
+
 package main
 
 import (
@@ -18,6 +21,7 @@ const NumCore = 8
 const NextGen = 10
 const RandMode = false
 const VS_Human = false
+const Seed = 1 // 乱数のシード。同じ値であれば学習を再現できる
 
 const N = 8
 
@@ -26,10 +30,12 @@ func main() {
 	// 学習開始の世代数。既にe世代まで学習済みの場合、64206などの自然数を設定する
 	e := -1
 
+	rng := rand.New(rand.NewSource(Seed))
+
 	// 乱数の初期値を設定。もし学習済みの特定世代のデータを使用する場合は特定世代データを読み込み
 	nns := []*gonn.NeuralNetwork{}
 	for i := 0; i < NumParent; i++ {
-		nn := gonn.NewNeuralNetwork(N*N+1, N*N, 200, "sigmoid-sigmoid")
+		nn := gonn.NewNeuralNetworkRand(N*N+1, N*N, 200, "sigmoid-sigmoid", rng)
 		nns = append(nns, nn)
 	}
 
@@ -46,7 +52,7 @@ func main() {
 		cases := []Case{}
 		for i := 0; i < len(nns); i++ {
 			for jj := 0; jj < NumVS; jj++ {
-				j := rand.Intn(len(nns))
+				j := rng.Intn(len(nns))
 				// i vs j を試合パターンに追加
 				cases = append(cases, Case{
 					I: i,
@@ -104,7 +110,7 @@ func main() {
 
 		// 突然変異を起こしつつ、子世代を生成する
 		er := 0.002
-		cs := gonn.Crossover(nns[:NextGen], NumParent, er)
+		cs := gonn.CrossoverRand(nns[:NextGen], NumParent, er, rng)
 		nns = cs
 	}
 }
@@ -0,0 +1,189 @@
+package gonn
+
+import (
+	"math"
+)
+
+// SchedulePoint identifies the point of training a learning rate is chosen for.
+type SchedulePoint struct {
+	Epoch int
+	// Step is the number of optimizer steps taken since training started.
+	Step          int
+	StepsPerEpoch int
+	Epochs        int
+}
+
+// epochProgress returns the epoch as a real number including the fraction of
+// the current epoch already done.
+func (p SchedulePoint) epochProgress() float64 {
+	if p.StepsPerEpoch == 0 {
+		return float64(p.Epoch)
+	}
+	return float64(p.Epoch) + float64(p.Step%p.StepsPerEpoch)/float64(p.StepsPerEpoch)
+}
+
+// Scheduler decides the learning rate of the optimizer during Fit. Rate is
+// called before every optimizer step; base is the learning rate the optimizer
+// was configured with.
+type Scheduler interface {
+	Rate(base float64, point SchedulePoint) float64
+}
+
+// LossObserver is implemented by schedulers that adapt to the loss. Fit calls
+// ObserveLoss after every epoch with the validation loss, or the training loss
+// when there is no validation set.
+type LossObserver interface {
+	ObserveLoss(loss float64)
+}
+
+// StepDecay multiplies the learning rate by Gamma every StepSize epochs.
+type StepDecay struct {
+	StepSize int
+	Gamma    float64
+}
+
+func (s StepDecay) Rate(base float64, point SchedulePoint) float64 {
+	if s.StepSize <= 0 {
+		return base
+	}
+	return base * math.Pow(s.Gamma, float64(point.Epoch/s.StepSize))
+}
+
+// ExponentialDecay multiplies the learning rate by Gamma every epoch.
+type ExponentialDecay struct {
+	Gamma float64
+}
+
+func (s ExponentialDecay) Rate(base float64, point SchedulePoint) float64 {
+	return base * math.Pow(s.Gamma, float64(point.Epoch))
+}
+
+// CosineAnnealing anneals the learning rate from the base rate to MinRate
+// along a cosine over Period epochs, then restarts. Every restart multiplies
+// the period by Mult; a Mult of 0 is treated as 1.
+type CosineAnnealing struct {
+	Period  int
+	Mult    float64
+	MinRate float64
+}
+
+func (s CosineAnnealing) Rate(base float64, point SchedulePoint) float64 {
+	if s.Period <= 0 {
+		return base
+	}
+	mult := s.Mult
+	if mult < 1 {
+		mult = 1
+	}
+	t := point.epochProgress()
+	period := float64(s.Period)
+	for t >= period {
+		t -= period
+		period *= mult
+	}
+	return s.MinRate + (base-s.MinRate)*(1+math.Cos(math.Pi*t/period))/2
+}
+
+// LinearWarmup raises the learning rate linearly from 0 to the base rate over
+// the first Steps optimizer steps and then follows After, or stays at the base
+// rate when After is nil.
+type LinearWarmup struct {
+	Steps int
+	After Scheduler
+}
+
+func (s LinearWarmup) Rate(base float64, point SchedulePoint) float64 {
+	if point.Step < s.Steps {
+		return base * float64(point.Step+1) / float64(s.Steps)
+	}
+	if s.After == nil {
+		return base
+	}
+	return s.After.Rate(base, point)
+}
+
+// OneCycle implements the one-cycle policy: the learning rate rises from
+// MaxRate/DivFactor to MaxRate over the first PctStart of training and then
+// anneals to MaxRate/(DivFactor*FinalDivFactor). Zero fields take the usual
+// defaults of PctStart 0.3, DivFactor 25 and FinalDivFactor 1e4, and a zero
+// MaxRate uses the base rate.
+type OneCycle struct {
+	MaxRate        float64
+	PctStart       float64
+	DivFactor      float64
+	FinalDivFactor float64
+}
+
+func (s OneCycle) Rate(base float64, point SchedulePoint) float64 {
+	maxRate, pctStart, div, finalDiv := s.MaxRate, s.PctStart, s.DivFactor, s.FinalDivFactor
+	if maxRate == 0 {
+		maxRate = base
+	}
+	if pctStart == 0 {
+		pctStart = 0.3
+	}
+	if div == 0 {
+		div = 25
+	}
+	if finalDiv == 0 {
+		finalDiv = 1e4
+	}
+	initial := maxRate / div
+	final := initial / finalDiv
+
+	total := float64(point.Epochs * point.StepsPerEpoch)
+	if total <= 1 {
+		return maxRate
+	}
+	progress := float64(point.Step) / (total - 1)
+	anneal := func(from, to, t float64) float64 {
+		return to + (from-to)*(1+math.Cos(math.Pi*t))/2
+	}
+	if progress < pctStart {
+		return anneal(initial, maxRate, progress/pctStart)
+	}
+	return anneal(maxRate, final, (progress-pctStart)/(1-pctStart))
+}
+
+// ReduceOnPlateau multiplies the learning rate by Factor whenever the observed
+// loss has not improved by more than MinDelta for Patience epochs, without
+// going below MinRate. A zero Factor is treated as 0.1.
+type ReduceOnPlateau struct {
+	Factor   float64
+	Patience int
+	MinDelta float64
+	MinRate  float64
+
+	scale float64
+	best  float64
+	wait  int
+	seen  bool
+}
+
+func (s *ReduceOnPlateau) Rate(base float64, point SchedulePoint) float64 {
+	if s.scale == 0 {
+		s.scale = 1
+	}
+	return math.Max(base*s.scale, s.MinRate)
+}
+
+func (s *ReduceOnPlateau) ObserveLoss(loss float64) {
+	if s.scale == 0 {
+		s.scale = 1
+	}
+	if !s.seen || loss < s.best-s.MinDelta {
+		s.best = loss
+		s.seen = true
+		s.wait = 0
+		return
+	}
+	s.wait++
+	if s.wait >= s.Patience {
+		factor := s.Factor
+		if factor == 0 {
+			factor = 0.1
+		}
+		s.scale *= factor
+		s.wait = 0
+	}
+}
@@ -0,0 +1,259 @@
+package gonn
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Sequential is a model made of layers applied one after another.
+//
+// Inference (Forward, ForwardBatch, ForwardInto, Evaluate and saving the
+// weights) only reads the model and is safe for concurrent use. Fit and the
+// Load methods lock the model while they change the weights, so they may run
+// alongside inference: Fit takes the lock for every batch, and predictions see
+// the weights as they were before or after an optimizer step, never in
+// between. Changing Layers or Param values directly is not guarded.
+type Sequential struct {
+	Layers []Layer
+	loss   Loss
+	// defaultLoss is used instead of MSE when no loss has been set, such as
+	// the cross-entropy NeuralNetwork selects for a softmax output.
+	defaultLoss Loss
+	// mu guards the weights and buffers of the layers.
+	mu sync.RWMutex
+	// scratch holds the intermediate buffers of ForwardInto.
+	scratch sync.Pool
+}
+
+// NewSequential returns a model stacking the given layers in order.
+func NewSequential(layers ...Layer) *Sequential {
+	return &Sequential{Layers: layers}
+}
+
+// SetLoss selects the loss minimized during training by its registered name,
+// such as "mse" (the default), "cross-entropy" for softmax outputs or
+// "binary-cross-entropy" for sigmoid outputs.
+func (s *Sequential) SetLoss(name string) error {
+	l, err := GetLoss(name)
+	if err != nil {
+		return err
+	}
+	s.SetLossFunction(l)
+	return nil
+}
+
+// SetLossFunction sets the loss minimized during training.
+func (s *Sequential) SetLossFunction(l Loss) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loss = l
+}
+
+// LossFunction returns the loss minimized during training.
+func (s *Sequential) LossFunction() Loss {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lossFunction()
+}
+
+func (s *Sequential) lossFunction() Loss {
+	if s.loss != nil {
+		return s.loss
+	}
+	if s.defaultLoss != nil {
+		return s.defaultLoss
+	}
+	return MSE{}
+}
+
+// Add appends a layer to the end of the model.
+func (s *Sequential) Add(layer Layer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Layers = append(s.Layers, layer)
+}
+
+// Forward returns the output of the model for a single input. It does not
+// modify the model when every layer implements Predictor.
+func (s *Sequential) Forward(input []float64) []float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.predict([][]float64{input})[0]
+}
+
+// ForwardBatch returns the outputs of the model for a batch of inputs,
+// computing every dense layer as a single matrix-matrix product. Like Forward,
+// it does not modify the model when every layer implements Predictor.
+func (s *Sequential) ForwardBatch(inputs [][]float64) [][]float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.predict(inputs)
+}
+
+// ForwardInto writes the output of the model for a single input to dst, which
+// must hold at least as many values as the output. When the model only has
+// Dense layers with built-in activations it does not allocate, reusing
+// intermediate buffers across calls; it is safe for concurrent use.
+func (s *Sequential) ForwardInto(dst, input []float64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, layer := range s.Layers {
+		if _, ok := layer.(*Dense); !ok {
+			copy(dst, s.predict([][]float64{input})[0])
+			return
+		}
+	}
+	buffers, _ := s.scratch.Get().(*forwardBuffers)
+	if buffers == nil {
+		buffers = &forwardBuffers{}
+	}
+	x := input
+	for i, layer := range s.Layers {
+		d := layer.(*Dense)
+		output := dst
+		if i < len(s.Layers)-1 {
+			output = buffers.get(i, d.outputSize)
+		}
+		d.forwardInto(output, x)
+		x = output[:d.outputSize]
+	}
+	s.scratch.Put(buffers)
+}
+
+// forwardBuffers holds one buffer per hidden layer for ForwardInto.
+type forwardBuffers struct {
+	layers [][]float64
+}
+
+func (b *forwardBuffers) get(i, size int) []float64 {
+	for len(b.layers) <= i {
+		b.layers = append(b.layers, nil)
+	}
+	if cap(b.layers[i]) < size {
+		b.layers[i] = make([]float64, size)
+	}
+	return b.layers[i][:size]
+}
+
+func (s *Sequential) predict(inputs [][]float64) [][]float64 {
+	for _, layer := range s.Layers {
+		inputs = predictLayer(layer, inputs)
+	}
+	return inputs
+}
+
+func (s *Sequential) forward(inputs [][]float64) [][]float64 {
+	for _, layer := range s.Layers {
+		inputs = layer.Forward(inputs)
+	}
+	return inputs
+}
+
+func (s *Sequential) backward(grads [][]float64) [][]float64 {
+	return s.backwardFrom(len(s.Layers)-1, grads)
+}
+
+func (s *Sequential) backwardFrom(last int, grads [][]float64) [][]float64 {
+	for i := last; i >= 0; i-- {
+		grads = s.Layers[i].Backward(grads)
+	}
+	return grads
+}
+
+// backwardLoss backpropagates l for outputs, the result of the last forward
+// pass, against targets and returns the summed loss. Gradients are multiplied
+// by scale before backpropagation. Softmax with cross-entropy and sigmoid with
+// binary cross-entropy skip the activation and use the fused y - t gradient.
+func (s *Sequential) backwardLoss(l Loss, outputs, targets [][]float64, scale float64) float64 {
+	total := 0.0
+	for n := range outputs {
+		total += l.Value(outputs[n], targets[n])
+	}
+
+	last := len(s.Layers) - 1
+	if f, ok := l.(fusedLoss); ok {
+		if d, ok := s.Layers[last].(*Dense); ok && f.fuses(d.activation) {
+			deltas := make([][]float64, len(outputs))
+			for n := range outputs {
+				deltas[n] = scaled(MSE{}.Gradient(outputs[n], targets[n]), scale)
+			}
+			s.backwardFrom(last-1, d.backwardDelta(deltas))
+			return total
+		}
+	}
+
+	grads := make([][]float64, len(outputs))
+	for n := range outputs {
+		grads[n] = scaled(l.Gradient(outputs[n], targets[n]), scale)
+	}
+	s.backward(grads)
+	return total
+}
+
+// replicate returns a copy of the model for data-parallel training, sharing
+// the parameter values but not the gradients.
+func (s *Sequential) replicate() (*Sequential, error) {
+	replica := &Sequential{loss: s.loss, defaultLoss: s.defaultLoss}
+	for _, layer := range s.Layers {
+		if err := checkReplicator(layer); err != nil {
+			return nil, err
+		}
+		replica.Layers = append(replica.Layers, layer.(Replicator).Replicate())
+	}
+	return replica, nil
+}
+
+// checkReplicator returns an error if layer, or a layer it wraps, does not
+// implement Replicator.
+func checkReplicator(layer Layer) error {
+	for {
+		if _, ok := layer.(Replicator); !ok {
+			return fmt.Errorf("layer %T does not support data-parallel training", layer)
+		}
+		w, ok := layer.(wrapper)
+		if !ok {
+			return nil
+		}
+		layer = w.wrapped()
+	}
+}
+
+// Params returns the trainable parameters of every layer in order.
+func (s *Sequential) Params() []*Param {
+	params := []*Param{}
+	for _, layer := range s.Layers {
+		params = append(params, layer.Params()...)
+	}
+	return params
+}
+
+// Buffers returns the state of every layer implementing Buffered in order.
+func (s *Sequential) Buffers() [][][]float64 {
+	buffers := [][][]float64{}
+	for _, layer := range s.Layers {
+		if b, ok := layer.(Buffered); ok {
+			buffers = append(buffers, b.Buffers()...)
+		}
+	}
+	return buffers
+}
+
+// ZeroGrad resets the accumulated gradients of every parameter.
+func (s *Sequential) ZeroGrad() {
+	for _, p := range s.Params() {
+		for _, row := range p.Grad {
+			for i := range row {
+				row[i] = 0
+			}
+		}
+	}
+}
+
+func scaled(values []float64, scale float64) []float64 {
+	if scale != 1 {
+		for i := range values {
+			values[i] *= scale
+		}
+	}
+	return values
+}
@@ -0,0 +1,109 @@
+package gonn
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// plainActivation hides ApplyTo from an activation, so that Dense falls back to
+// Apply.
+type plainActivation struct {
+	Activation
+}
+
+func TestForwardBatchAndForwardIntoMatchForward(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		model func(t *testing.T, rng *rand.Rand) *Sequential
+	}{
+		{
+			name: "Dense",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewNeuralNetworkRand(7, 9, 5, "relu-softmax", rng).Sequential
+			},
+		},
+		{
+			name: "DenseCustomActivation",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewDenseRand(7, 9, plainActivation{mustActivation(t, "tanh")}, rng),
+					NewDenseRand(9, 6, mustActivation(t, "gelu"), rng),
+					NewDenseRand(6, 5, plainActivation{mustActivation(t, "sigmoid")}, rng),
+				)
+			},
+		},
+		{
+			name: "Mixed",
+			model: func(t *testing.T, rng *rand.Rand) *Sequential {
+				return NewSequential(
+					NewDenseRand(7, 9, mustActivation(t, "relu"), rng),
+					NewBatchNorm(9),
+					NewDropout(0.5, rng),
+					NewLayerNorm(9),
+					NewDenseRand(9, 5, mustActivation(t, "sigmoid"), rng),
+				)
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			model := c.model(t, rng)
+			// 4 行ずつの行列積と余りの行の両方を通るよう、4 の倍数でない件数にする
+			inputs := randomInputs(rng, 11, 7)
+
+			batch := model.ForwardBatch(inputs)
+			output := make([]float64, 5)
+			for n, input := range inputs {
+				want := model.Forward(input)
+				if !reflect.DeepEqual(batch[n], want) {
+					t.Errorf("ForwardBatch()[%d] = %v, want %v", n, batch[n], want)
+				}
+				model.ForwardInto(output, input)
+				if !reflect.DeepEqual(output, want) {
+					t.Errorf("ForwardInto(%d) = %v, want %v", n, output, want)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkNetwork returns a network of the size the osero sample uses and 64
+// boards to evaluate.
+func benchmarkNetwork() (*NeuralNetwork, [][]float64) {
+	rng := rand.New(rand.NewSource(1))
+	nn := NewNeuralNetworkRand(65, 64, 200, "sigmoid-sigmoid", rng)
+	return nn, randomInputs(rng, 64, 65)
+}
+
+func BenchmarkForward(b *testing.B) {
+	nn, boards := benchmarkNetwork()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, board := range boards {
+			nn.Forward(board)
+		}
+	}
+}
+
+func BenchmarkForwardBatch(b *testing.B) {
+	nn, boards := benchmarkNetwork()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		nn.ForwardBatch(boards)
+	}
+}
+
+func BenchmarkForwardInto(b *testing.B) {
+	nn, boards := benchmarkNetwork()
+	output := make([]float64, 200)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, board := range boards {
+			nn.ForwardInto(output, board)
+		}
+	}
+}
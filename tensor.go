@@ -0,0 +1,475 @@
+package gonn
+
+import (
+	"fmt"
+	"math"
+)
+
+// Tensor is an n-dimensional array of float64 values stored in a flat slice.
+// The value at index (i0, i1, ...) is Data[i0*Strides[0] + i1*Strides[1] + ...].
+// Tensors created by NewTensor are contiguous and row-major; Transpose returns
+// a view sharing Data with permuted strides.
+type Tensor struct {
+	Shape   []int
+	Strides []int
+	Data    []float64
+}
+
+// NewTensor returns a contiguous tensor of zeros with the given shape.
+func NewTensor(shape ...int) *Tensor {
+	return TensorFrom(make([]float64, shapeSize(shape)), shape...)
+}
+
+// TensorFrom returns a contiguous tensor using data as its storage.
+func TensorFrom(data []float64, shape ...int) *Tensor {
+	if len(data) != shapeSize(shape) {
+		panic(fmt.Sprintf("tensor: %d values do not fit shape %v", len(data), shape))
+	}
+	return &Tensor{Shape: append([]int(nil), shape...), Strides: rowMajorStrides(shape), Data: data}
+}
+
+// TensorFromRows copies the rows of a matrix into a new 2D tensor.
+func TensorFromRows(rows [][]float64) *Tensor {
+	cols := 0
+	if len(rows) > 0 {
+		cols = len(rows[0])
+	}
+	return batchTensor(rows, cols)
+}
+
+// batchTensor copies rows, which all have cols values, into a new 2D tensor.
+func batchTensor(rows [][]float64, cols int) *Tensor {
+	t := NewTensor(len(rows), cols)
+	for i, row := range rows {
+		copy(t.Data[i*cols:(i+1)*cols], row)
+	}
+	return t
+}
+
+// flatBatch copies rows, which may have different lengths, one after another
+// into a 1D tensor and returns it with the lengths of the rows, so that ragged
+// batches can go through element-wise operations.
+func flatBatch(rows [][]float64) (*Tensor, []int) {
+	lengths := make([]int, len(rows))
+	size := 0
+	for i, row := range rows {
+		lengths[i] = len(row)
+		size += len(row)
+	}
+	t := NewTensor(size)
+	offset := 0
+	for _, row := range rows {
+		offset += copy(t.Data[offset:], row)
+	}
+	return t, lengths
+}
+
+// splitBatch returns the rows of a tensor built like flatBatch, sharing its
+// storage.
+func splitBatch(t *Tensor, lengths []int) [][]float64 {
+	data := t.Contiguous().Data
+	rows := make([][]float64, len(lengths))
+	for i, length := range lengths {
+		rows[i], data = data[:length:length], data[length:]
+	}
+	return rows
+}
+
+// argmaxRows returns the column of the largest value of every row of a
+// contiguous 2D tensor, the first one on ties.
+func (t *Tensor) argmaxRows() []int {
+	cols := t.Shape[1]
+	indices := make([]int, t.Shape[0])
+	for i := range indices {
+		row := t.Data[i*cols : (i+1)*cols]
+		for j, v := range row {
+			if v > row[indices[i]] {
+				indices[i] = j
+			}
+		}
+	}
+	return indices
+}
+
+func shapeSize(shape []int) int {
+	size := 1
+	for _, d := range shape {
+		size *= d
+	}
+	return size
+}
+
+func rowMajorStrides(shape []int) []int {
+	strides := make([]int, len(shape))
+	stride := 1
+	for i := len(shape) - 1; i >= 0; i-- {
+		strides[i] = stride
+		stride *= shape[i]
+	}
+	return strides
+}
+
+// Size returns the number of values in the tensor.
+func (t *Tensor) Size() int {
+	return shapeSize(t.Shape)
+}
+
+func (t *Tensor) offset(index []int) int {
+	if len(index) != len(t.Shape) {
+		panic(fmt.Sprintf("tensor: index %v does not match shape %v", index, t.Shape))
+	}
+	offset := 0
+	for i, x := range index {
+		offset += x * t.Strides[i]
+	}
+	return offset
+}
+
+// At returns the value at index.
+func (t *Tensor) At(index ...int) float64 {
+	return t.Data[t.offset(index)]
+}
+
+// Set sets the value at index to v.
+func (t *Tensor) Set(v float64, index ...int) {
+	t.Data[t.offset(index)] = v
+}
+
+// IsContiguous reports whether the values are stored in row-major order.
+func (t *Tensor) IsContiguous() bool {
+	stride := 1
+	for i := len(t.Shape) - 1; i >= 0; i-- {
+		if t.Shape[i] != 1 && t.Strides[i] != stride {
+			return false
+		}
+		stride *= t.Shape[i]
+	}
+	return true
+}
+
+// Contiguous returns t if it is contiguous and a contiguous copy otherwise.
+func (t *Tensor) Contiguous() *Tensor {
+	if t.IsContiguous() {
+		return t
+	}
+	return t.Clone()
+}
+
+// Clone returns a contiguous copy of t.
+func (t *Tensor) Clone() *Tensor {
+	c := NewTensor(t.Shape...)
+	i := 0
+	t.each(func(offset int) {
+		c.Data[i] = t.Data[offset]
+		i++
+	})
+	return c
+}
+
+// each calls f with the offset of every value in row-major order.
+func (t *Tensor) each(f func(offset int)) {
+	if t.IsContiguous() {
+		for i := 0; i < t.Size(); i++ {
+			f(i)
+		}
+		return
+	}
+	index := make([]int, len(t.Shape))
+	for n := t.Size(); n > 0; n-- {
+		f(t.offset(index))
+		for d := len(index) - 1; d >= 0; d-- {
+			index[d]++
+			if index[d] < t.Shape[d] {
+				break
+			}
+			index[d] = 0
+		}
+	}
+}
+
+// Reshape returns a tensor with the same values and the given shape, sharing
+// storage with t when t is contiguous.
+func (t *Tensor) Reshape(shape ...int) *Tensor {
+	c := t.Contiguous()
+	return TensorFrom(c.Data, shape...)
+}
+
+// Transpose returns a view of t with its last two axes swapped.
+func (t *Tensor) Transpose() *Tensor {
+	n := len(t.Shape)
+	if n < 2 {
+		return t
+	}
+	v := &Tensor{
+		Shape:   append([]int(nil), t.Shape...),
+		Strides: append([]int(nil), t.Strides...),
+		Data:    t.Data,
+	}
+	v.Shape[n-1], v.Shape[n-2] = v.Shape[n-2], v.Shape[n-1]
+	v.Strides[n-1], v.Strides[n-2] = v.Strides[n-2], v.Strides[n-1]
+	return v
+}
+
+// Rows returns the rows of a contiguous 2D tensor as slices sharing its
+// storage.
+func (t *Tensor) Rows() [][]float64 {
+	if len(t.Shape) != 2 || !t.IsContiguous() {
+		panic(fmt.Sprintf("tensor: rows of a non-contiguous or %dD tensor", len(t.Shape)))
+	}
+	rows := make([][]float64, t.Shape[0])
+	cols := t.Shape[1]
+	for i := range rows {
+		rows[i] = t.Data[i*cols : (i+1)*cols : (i+1)*cols]
+	}
+	return rows
+}
+
+// MatMul returns the matrix product of the 2D tensors a and b.
+func MatMul(a, b *Tensor) *Tensor {
+	dst := NewTensor(a.Shape[0], b.Shape[1])
+	matMulAdd(dst, a, b)
+	return dst
+}
+
+// matMulAdd adds the matrix product of a and b to the contiguous tensor dst.
+// The loops run in i, k, j order so that the rows of b and dst are walked
+// sequentially, and four rows of a are processed together so that every row
+// of b loaded from memory is used four times.
+func matMulAdd(dst, a, b *Tensor) {
+	if len(a.Shape) != 2 || len(b.Shape) != 2 || a.Shape[1] != b.Shape[0] {
+		panic(fmt.Sprintf("tensor: cannot multiply %v by %v", a.Shape, b.Shape))
+	}
+	if dst.Shape[0] != a.Shape[0] || dst.Shape[1] != b.Shape[1] {
+		panic(fmt.Sprintf("tensor: product of %v and %v does not fit %v", a.Shape, b.Shape, dst.Shape))
+	}
+	a, b = a.Contiguous(), b.Contiguous()
+	m, k, n := a.Shape[0], a.Shape[1], b.Shape[1]
+	i := 0
+	for ; i+4 <= m; i += 4 {
+		out0 := dst.Data[i*n : (i+1)*n]
+		out1 := dst.Data[(i+1)*n : (i+2)*n]
+		out2 := dst.Data[(i+2)*n : (i+3)*n]
+		out3 := dst.Data[(i+3)*n : (i+4)*n]
+		for p := 0; p < k; p++ {
+			x0, x1, x2, x3 := a.Data[i*k+p], a.Data[(i+1)*k+p], a.Data[(i+2)*k+p], a.Data[(i+3)*k+p]
+			if x0 == 0 && x1 == 0 && x2 == 0 && x3 == 0 {
+				continue
+			}
+			row := b.Data[p*n : (p+1)*n]
+			out0, out1, out2, out3 := out0[:len(row)], out1[:len(row)], out2[:len(row)], out3[:len(row)]
+			for j, y := range row {
+				out0[j] += x0 * y
+				out1[j] += x1 * y
+				out2[j] += x2 * y
+				out3[j] += x3 * y
+			}
+		}
+	}
+	for ; i < m; i++ {
+		out := dst.Data[i*n : (i+1)*n]
+		for p, x := range a.Data[i*k : (i+1)*k] {
+			if x == 0 {
+				continue
+			}
+			row := b.Data[p*n : (p+1)*n]
+			for j, y := range row {
+				out[j] += x * y
+			}
+		}
+	}
+}
+
+// Add returns a + b with broadcasting.
+func Add(a, b *Tensor) *Tensor {
+	return broadcast(a, b, func(x, y float64) float64 { return x + y })
+}
+
+// Sub returns a - b with broadcasting.
+func Sub(a, b *Tensor) *Tensor {
+	return broadcast(a, b, func(x, y float64) float64 { return x - y })
+}
+
+// Mul returns the element-wise product of a and b with broadcasting.
+func Mul(a, b *Tensor) *Tensor {
+	return broadcast(a, b, func(x, y float64) float64 { return x * y })
+}
+
+// Div returns the element-wise quotient of a and b with broadcasting.
+func Div(a, b *Tensor) *Tensor {
+	return broadcast(a, b, func(x, y float64) float64 { return x / y })
+}
+
+// AddInPlace adds b, which must broadcast to the shape of t, to t.
+func (t *Tensor) AddInPlace(b *Tensor) {
+	t.apply(b, func(x, y float64) float64 { return x + y })
+}
+
+// broadcastShape returns the shape a and b broadcast to, following the NumPy
+// rules: shapes are aligned at their last axis and axes of size 1 stretch.
+func broadcastShape(a, b []int) []int {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	shape := make([]int, n)
+	for i := 1; i <= n; i++ {
+		da, db := 1, 1
+		if i <= len(a) {
+			da = a[len(a)-i]
+		}
+		if i <= len(b) {
+			db = b[len(b)-i]
+		}
+		switch {
+		case da == db || db == 1:
+			shape[n-i] = da
+		case da == 1:
+			shape[n-i] = db
+		default:
+			panic(fmt.Sprintf("tensor: shapes %v and %v do not broadcast", a, b))
+		}
+	}
+	return shape
+}
+
+// stridesFor returns the strides to read t as a tensor of the broadcast shape.
+func (t *Tensor) stridesFor(shape []int) []int {
+	strides := make([]int, len(shape))
+	skip := len(shape) - len(t.Shape)
+	for i := range t.Shape {
+		if t.Shape[i] != 1 {
+			strides[skip+i] = t.Strides[i]
+		}
+	}
+	return strides
+}
+
+// isSuffix reports whether b, without leading axes of size 1, is the end of
+// shape, so that a contiguous b repeats along the flat data of shape.
+func isSuffix(b, shape []int) bool {
+	for len(b) > 0 && b[0] == 1 {
+		b = b[1:]
+	}
+	if len(b) > len(shape) {
+		return false
+	}
+	for i := range b {
+		if b[i] != shape[len(shape)-len(b)+i] {
+			return false
+		}
+	}
+	return true
+}
+
+func broadcast(a, b *Tensor, f func(x, y float64) float64) *Tensor {
+	dst := NewTensor(broadcastShape(a.Shape, b.Shape)...)
+	dst.apply(a, func(_, x float64) float64 { return x })
+	dst.apply(b, f)
+	return dst
+}
+
+// apply sets every value x of the contiguous tensor t to f(x, y), with y the
+// matching value of b broadcast to the shape of t.
+func (t *Tensor) apply(b *Tensor, f func(x, y float64) float64) {
+	if !sameInts(broadcastShape(t.Shape, b.Shape), t.Shape) {
+		panic(fmt.Sprintf("tensor: shape %v does not broadcast to %v", b.Shape, t.Shape))
+	}
+	if b.IsContiguous() && isSuffix(b.Shape, t.Shape) {
+		size := b.Size()
+		for i := range t.Data {
+			t.Data[i] = f(t.Data[i], b.Data[i%size])
+		}
+		return
+	}
+	strides := b.stridesFor(t.Shape)
+	index := make([]int, len(t.Shape))
+	offset := 0
+	for i := range t.Data {
+		t.Data[i] = f(t.Data[i], b.Data[offset])
+		for d := len(index) - 1; d >= 0; d-- {
+			index[d]++
+			offset += strides[d]
+			if index[d] < t.Shape[d] {
+				break
+			}
+			offset -= strides[d] * index[d]
+			index[d] = 0
+		}
+	}
+}
+
+func sameInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns a new tensor with f applied to every value.
+func (t *Tensor) Apply(f func(float64) float64) *Tensor {
+	dst := t.Clone()
+	for i, x := range dst.Data {
+		dst.Data[i] = f(x)
+	}
+	return dst
+}
+
+// Scale returns t multiplied by s.
+func (t *Tensor) Scale(s float64) *Tensor {
+	return t.Apply(func(x float64) float64 { return x * s })
+}
+
+// Sum returns the sums along axis. The reduced axis is kept with size 1 so
+// that the result broadcasts against t.
+func (t *Tensor) Sum(axis int) *Tensor {
+	return t.reduce(axis, 0, func(acc, x float64) float64 { return acc + x })
+}
+
+// Mean returns the means along axis, keeping the axis with size 1.
+func (t *Tensor) Mean(axis int) *Tensor {
+	return t.Sum(axis).Scale(1 / float64(t.Shape[axis]))
+}
+
+// Max returns the maxima along axis, keeping the axis with size 1.
+func (t *Tensor) Max(axis int) *Tensor {
+	return t.reduce(axis, math.Inf(-1), math.Max)
+}
+
+func (t *Tensor) reduce(axis int, init float64, f func(acc, x float64) float64) *Tensor {
+	shape := append([]int(nil), t.Shape...)
+	shape[axis] = 1
+	dst := NewTensor(shape...)
+	for i := range dst.Data {
+		dst.Data[i] = init
+	}
+	strides := dst.stridesFor(t.Shape)
+	index := make([]int, len(t.Shape))
+	offset := 0
+	t.each(func(o int) {
+		dst.Data[offset] = f(dst.Data[offset], t.Data[o])
+		for d := len(index) - 1; d >= 0; d-- {
+			index[d]++
+			offset += strides[d]
+			if index[d] < t.Shape[d] {
+				break
+			}
+			offset -= strides[d] * index[d]
+			index[d] = 0
+		}
+	})
+	return dst
+}
+
+// SumAll returns the sum of every value.
+func (t *Tensor) SumAll() float64 {
+	sum := 0.0
+	t.each(func(offset int) {
+		sum += t.Data[offset]
+	})
+	return sum
+}
@@ -0,0 +1,262 @@
+package gonn
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	for _, c := range []struct {
+		a, b, want []int
+	}{
+		{[]int{2, 3}, []int{2, 3}, []int{2, 3}},
+		{[]int{2, 3}, []int{1, 3}, []int{2, 3}},
+		{[]int{2, 3}, []int{3}, []int{2, 3}},
+		{[]int{2, 3}, []int{2, 1}, []int{2, 3}},
+		{[]int{2, 1}, []int{1, 3}, []int{2, 3}},
+		{[]int{3}, []int{2, 1}, []int{2, 3}},
+		{[]int{2, 3, 4}, []int{3, 1}, []int{2, 3, 4}},
+		{[]int{2, 1, 4}, []int{3, 1}, []int{2, 3, 4}},
+		{[]int{1}, []int{2, 2}, []int{2, 2}},
+	} {
+		a, b := sequence(c.a...), sequence(c.b...).Scale(10)
+		for name, got := range map[string]*Tensor{
+			"Add":        Add(a, b),
+			"Add(views)": Add(a, b.Transpose().Contiguous().Transpose()),
+		} {
+			if !sameInts(got.Shape, c.want) {
+				t.Errorf("%s of %v and %v has shape %v, want %v", name, c.a, c.b, got.Shape, c.want)
+				continue
+			}
+			index := make([]int, len(c.want))
+			for i := range got.Data {
+				if want := broadcastAt(a, index) + broadcastAt(b, index); got.Data[i] != want {
+					t.Errorf("%s of %v and %v at %v = %v, want %v", name, c.a, c.b, index, got.Data[i], want)
+				}
+				next(index, c.want)
+			}
+		}
+	}
+}
+
+func TestBroadcastPanics(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		f    func()
+	}{
+		{"Add", func() { Add(NewTensor(2, 3), NewTensor(2)) }},
+		{"Mul", func() { Mul(NewTensor(2, 3), NewTensor(3, 3)) }},
+		{"AddInPlace", func() { NewTensor(1, 3).AddInPlace(NewTensor(2, 3)) }},
+		{"TensorFrom", func() { TensorFrom(make([]float64, 5), 2, 3) }},
+		{"At", func() { NewTensor(2, 3).At(1) }},
+		{"Rows", func() { NewTensor(2, 3).Transpose().Rows() }},
+		{"Rows3D", func() { NewTensor(2, 3, 4).Rows() }},
+		{"MatMul", func() { MatMul(NewTensor(2, 3), NewTensor(2, 3)) }},
+		{"matMulAdd", func() { matMulAdd(NewTensor(2, 2), NewTensor(2, 3), NewTensor(3, 4)) }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic")
+				}
+			}()
+			c.f()
+		})
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	x := sequence(2, 3)
+	v := x.Transpose()
+	if !sameInts(v.Shape, []int{3, 2}) || v.IsContiguous() {
+		t.Fatalf("Transpose has shape %v and contiguous %v", v.Shape, v.IsContiguous())
+	}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			if v.At(j, i) != x.At(i, j) {
+				t.Errorf("At(%d, %d) = %v, want %v", j, i, v.At(j, i), x.At(i, j))
+			}
+		}
+	}
+
+	// ビューは元のテンソルとデータを共有し、Contiguous はコピーを返す
+	v.Set(100, 2, 1)
+	if x.At(1, 2) != 100 {
+		t.Error("Set on the view did not change the tensor")
+	}
+	c := v.Contiguous()
+	if !c.IsContiguous() || !reflect.DeepEqual(c.Data, []float64{1, 4, 2, 5, 3, 100}) {
+		t.Errorf("Contiguous = %v", c.Data)
+	}
+	c.Set(0, 0, 0)
+	if x.At(0, 0) != 1 {
+		t.Error("Contiguous of a view shares its data")
+	}
+	if x.Contiguous() != x {
+		t.Error("Contiguous of a contiguous tensor is a copy")
+	}
+	if got := v.Reshape(6).Data; !reflect.DeepEqual(got, []float64{1, 4, 2, 5, 3, 100}) {
+		t.Errorf("Reshape of the view = %v", got)
+	}
+	if !reflect.DeepEqual(v.Transpose().Clone(), x) {
+		t.Error("transposing twice does not give the tensor back")
+	}
+
+	// 3 次元以上では最後の 2 軸を入れ替える
+	y := sequence(2, 3, 4)
+	w := y.Transpose()
+	if !sameInts(w.Shape, []int{2, 4, 3}) || w.At(1, 3, 2) != y.At(1, 2, 3) {
+		t.Errorf("3D Transpose has shape %v and At(1, 3, 2) = %v, want %v", w.Shape, w.At(1, 3, 2), y.At(1, 2, 3))
+	}
+	// 大きさ 1 の軸のストライドは連続性に影響しない
+	if !NewTensor(1, 3).Transpose().IsContiguous() {
+		t.Error("a transposed row is not contiguous")
+	}
+}
+
+func TestReductions(t *testing.T) {
+	x := TensorFrom([]float64{1, 5, 3, 4, 2, 6}, 2, 3)
+	for _, c := range []struct {
+		name  string
+		got   *Tensor
+		shape []int
+		want  []float64
+	}{
+		{"Sum(0)", x.Sum(0), []int{1, 3}, []float64{5, 7, 9}},
+		{"Sum(1)", x.Sum(1), []int{2, 1}, []float64{9, 12}},
+		{"Mean(0)", x.Mean(0), []int{1, 3}, []float64{2.5, 3.5, 4.5}},
+		{"Mean(1)", x.Mean(1), []int{2, 1}, []float64{3, 4}},
+		{"Max(0)", x.Max(0), []int{1, 3}, []float64{4, 5, 6}},
+		{"Max(1)", x.Max(1), []int{2, 1}, []float64{5, 6}},
+		{"Transpose().Sum(0)", x.Transpose().Sum(0), []int{1, 2}, []float64{9, 12}},
+		{"Transpose().Max(1)", x.Transpose().Max(1), []int{3, 1}, []float64{4, 5, 6}},
+		{"Sum(1) of 3D", sequence(2, 3, 2).Sum(1), []int{2, 1, 2}, []float64{9, 12, 27, 30}},
+		{"Max(2) of 3D", sequence(2, 3, 2).Max(2), []int{2, 3, 1}, []float64{2, 4, 6, 8, 10, 12}},
+	} {
+		if !sameInts(c.got.Shape, c.shape) || !reflect.DeepEqual(c.got.Data, c.want) {
+			t.Errorf("%s = %v of shape %v, want %v of shape %v", c.name, c.got.Data, c.got.Shape, c.want, c.shape)
+		}
+	}
+	if got := x.Transpose().SumAll(); got != 21 {
+		t.Errorf("SumAll = %v, want 21", got)
+	}
+	// 縮約した軸は大きさ 1 で残るので、元のテンソルと演算できる
+	if got := Sub(x, x.Mean(1)).Data; !reflect.DeepEqual(got, []float64{-2, 2, 0, 0, -2, 2}) {
+		t.Errorf("x - Mean(1) = %v", got)
+	}
+}
+
+// sequence returns a tensor of the given shape holding 1, 2, 3, ... in
+// row-major order.
+func sequence(shape ...int) *Tensor {
+	t := NewTensor(shape...)
+	for i := range t.Data {
+		t.Data[i] = float64(i + 1)
+	}
+	return t
+}
+
+// broadcastAt returns the value of t at index of a shape t broadcasts to.
+func broadcastAt(t *Tensor, index []int) float64 {
+	index = index[len(index)-len(t.Shape):]
+	own := make([]int, len(t.Shape))
+	for i, d := range t.Shape {
+		if d != 1 {
+			own[i] = index[i]
+		}
+	}
+	return t.At(own...)
+}
+
+// next advances index to the next one of shape in row-major order.
+func next(index, shape []int) {
+	for d := len(index) - 1; d >= 0; d-- {
+		index[d]++
+		if index[d] < shape[d] {
+			return
+		}
+		index[d] = 0
+	}
+}
+
+func TestMatMulAdd(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// 4 行単位のブロックと余りの行の組み合わせをすべて試す
+	for m := 1; m <= 9; m++ {
+		a := TensorFromRows(randomInputs(rng, m, 5))
+		// 0 の値はスキップされるので、先頭の行と 3 列目を 0 にしておく
+		for p := 0; p < 5; p++ {
+			a.Set(0, 0, p)
+		}
+		for i := 0; i < m; i++ {
+			a.Set(0, i, 2)
+		}
+		b := TensorFromRows(randomInputs(rng, 5, 3))
+		dst := TensorFromRows(randomInputs(rng, m, 3))
+		want := naiveMatMulAdd(dst.Clone().Rows(), a, b)
+
+		matMulAdd(dst, a, b)
+		if got := dst.Rows(); !reflect.DeepEqual(got, want) {
+			t.Errorf("m = %d: matMulAdd = %v, want %v", m, got, want)
+		}
+		// 転置したビューは連続なコピーを経由して同じ結果になる
+		at := TensorFromRows(randomInputs(rng, 5, m)).Transpose()
+		bt := TensorFromRows(randomInputs(rng, 3, 5)).Transpose()
+		if got, want := MatMul(at, bt).Rows(), naiveMatMulAdd(NewTensor(m, 3).Rows(), at, bt); !reflect.DeepEqual(got, want) {
+			t.Errorf("m = %d: MatMul of views = %v, want %v", m, got, want)
+		}
+	}
+}
+
+// naiveMatMulAdd adds the product of a and b, computed value by value, to dst
+// and returns it.
+func naiveMatMulAdd(dst [][]float64, a, b *Tensor) [][]float64 {
+	for i := range dst {
+		for j := range dst[i] {
+			for p := 0; p < a.Shape[1]; p++ {
+				dst[i][j] += a.At(i, p) * b.At(p, j)
+			}
+		}
+	}
+	return dst
+}
+
+// The sizes of the benchmarks are those of the first layer of an MNIST model
+// trained in batches of 64.
+const (
+	benchmarkBatchSize  = 64
+	benchmarkInputSize  = 784
+	benchmarkOutputSize = 200
+)
+
+// BenchmarkMatMulLoops is the product of [][]float64 matrices with the loops
+// layers used before Tensor, walking the weights column by column.
+func BenchmarkMatMulLoops(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	inputs := randomInputs(rng, benchmarkBatchSize, benchmarkInputSize)
+	weights := randomInputs(rng, benchmarkInputSize, benchmarkOutputSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, input := range inputs {
+			z := make([]float64, benchmarkOutputSize)
+			for i := range z {
+				for j := range input {
+					z[i] += input[j] * weights[j][i]
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkMatMul(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x := TensorFromRows(randomInputs(rng, benchmarkBatchSize, benchmarkInputSize))
+	w := TensorFromRows(randomInputs(rng, benchmarkInputSize, benchmarkOutputSize))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		MatMul(x, w)
+	}
+}
@@ -0,0 +1,492 @@
+package gonn
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// TrainConfig controls how Fit trains a model.
+type TrainConfig struct {
+	Epochs    int
+	Optimizer Optimizer
+	// Scheduler changes the learning rate of Optimizer during training. The
+	// learning rate of Optimizer is restored when training ends.
+	Scheduler Scheduler
+	// Loss overrides the loss of the model when set.
+	Loss Loss
+	// BatchSize is the number of samples whose gradients are averaged for
+	// every optimizer step. Zero means 1.
+	BatchSize int
+	// Shuffle reorders the samples at the start of every epoch using Rand.
+	Shuffle bool
+	// Rand drives shuffling. A nil Rand uses a shared source seeded with the
+	// current time, so set it to make runs reproducible.
+	Rand *rand.Rand
+	// ClipValue limits every gradient to [-ClipValue, ClipValue] and ClipNorm
+	// rescales the gradients so that their global L2 norm is at most
+	// ClipNorm before every optimizer step. Zero disables clipping.
+	ClipValue float64
+	ClipNorm  float64
+	// Workers splits every mini-batch into shards processed by that many
+	// goroutines. The gradients of the shards are summed in worker order
+	// before the optimizer step, so results only depend on the seed and the
+	// number of workers. Every layer must implement Replicator when Workers
+	// is greater than 1.
+	Workers int
+	// Callbacks receive training events in order after Logger.
+	Callbacks []Callback
+	// Logger reports progress. A nil Logger prints the metrics of every epoch
+	// to standard output; use NoLogger to silence it.
+	Logger Callback
+
+	// ValidationInputs and ValidationOutputs are evaluated after every epoch.
+	ValidationInputs  [][]float64
+	ValidationOutputs [][]float64
+	// ValidationSplit holds out this fraction of the samples, taken from the
+	// end of inputs before any shuffling, for validation when no validation
+	// set is given.
+	ValidationSplit float64
+	// Patience stops training once the monitored loss has not improved by
+	// more than MinDelta for that many epochs. The validation loss is
+	// monitored when there is a validation set and the training loss
+	// otherwise. Zero disables early stopping.
+	Patience int
+	MinDelta float64
+	// RestoreBestWeights sets the parameters back to those of the epoch with
+	// the lowest monitored loss when training ends.
+	RestoreBestWeights bool
+}
+
+// TrainNeuralNetwork trains the model with plain stochastic gradient descent.
+// It does nothing when there are no samples and panics if inputs and outputs
+// do not have the same length.
+func (s *Sequential) TrainNeuralNetwork(inputs [][]float64, outputs [][]float64, learningRate float64, epochs int) {
+	if len(inputs) == 0 && len(outputs) == 0 {
+		return
+	}
+	if _, err := s.Train(inputs, outputs, NewSGD(learningRate), epochs); err != nil {
+		panic(err)
+	}
+}
+
+// Train trains the model one sample at a time, updating the parameters with
+// optimizer after every sample.
+func (s *Sequential) Train(inputs [][]float64, outputs [][]float64, optimizer Optimizer, epochs int) (*History, error) {
+	return s.Fit(inputs, outputs, TrainConfig{Epochs: epochs, Optimizer: optimizer})
+}
+
+// Fit trains the model on mini-batches of inputs and outputs as described by
+// config and returns the metrics of every epoch. When the layers are replaced
+// during training, as by loading weights of other sizes into a NeuralNetwork,
+// the new layers are trained from the next batch on.
+func (s *Sequential) Fit(inputs [][]float64, outputs [][]float64, config TrainConfig) (*History, error) {
+	if len(inputs) != len(outputs) {
+		return nil, fmt.Errorf("got %d inputs and %d outputs", len(inputs), len(outputs))
+	}
+	if config.Optimizer == nil {
+		return nil, errors.New("no optimizer is configured")
+	}
+	validationInputs, validationOutputs := config.ValidationInputs, config.ValidationOutputs
+	if len(validationInputs) != len(validationOutputs) {
+		return nil, fmt.Errorf("got %d validation inputs and %d validation outputs", len(validationInputs), len(validationOutputs))
+	}
+	if len(validationInputs) == 0 && config.ValidationSplit > 0 {
+		if config.ValidationSplit >= 1 {
+			return nil, fmt.Errorf("validation split must be less than 1: %v", config.ValidationSplit)
+		}
+		split := len(inputs) - int(float64(len(inputs))*config.ValidationSplit)
+		inputs, validationInputs = inputs[:split], inputs[split:]
+		outputs, validationOutputs = outputs[:split], outputs[split:]
+	}
+	if len(inputs) == 0 {
+		return nil, errors.New("no training samples")
+	}
+	l := config.Loss
+	if l == nil {
+		l = s.LossFunction()
+	}
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	rng := randOrDefault(config.Rand)
+
+	workers := config.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	// NeuralNetwork の LoadWeights は層を入れ替えうるので、ロックしてから層を読む
+	s.mu.RLock()
+	layers := s.Layers
+	replicas, err := s.replicas(len(inputs), batchSize, workers)
+	params := s.Params()
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]int, len(inputs))
+	for i := range order {
+		order[i] = i
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = defaultLogger
+	}
+	callbacks := append([]Callback{logger}, config.Callbacks...)
+
+	baseRate := config.Optimizer.GetLearningRate()
+	defer config.Optimizer.SetLearningRate(baseRate)
+	point := SchedulePoint{
+		StepsPerEpoch: (len(inputs) + batchSize - 1) / batchSize,
+		Epochs:        config.Epochs,
+	}
+
+	history := &History{BestEpoch: -1}
+	bestLoss := 0.0
+	var best [][][]float64
+	for epoch := 0; epoch < config.Epochs; epoch++ {
+		for _, c := range callbacks {
+			c.OnEpochBegin(epoch)
+		}
+		if config.Shuffle {
+			rng.Shuffle(len(order), func(i, j int) {
+				order[i], order[j] = order[j], order[i]
+			})
+		}
+
+		correct := 0 // 正解数をカウントするための変数
+		totalLoss := 0.0
+		for batch, start := 0, 0; start < len(order); batch, start = batch+1, start+batchSize {
+			end := start + batchSize
+			if end > len(order) {
+				end = len(order)
+			}
+			batchInputs := make([][]float64, 0, end-start)
+			batchOutputs := make([][]float64, 0, end-start)
+			for _, i := range order[start:end] {
+				batchInputs = append(batchInputs, inputs[i])
+				batchOutputs = append(batchOutputs, outputs[i])
+			}
+
+			// 推論と並行して呼ばれても重みの更新途中が見えないよう、バッチごとにロックする
+			s.mu.Lock()
+			if !sameSlice(layers, s.Layers) {
+				layers = s.Layers
+				replicas, err = s.replicas(len(inputs), batchSize, workers)
+				params = s.Params()
+				if err != nil {
+					s.mu.Unlock()
+					return nil, err
+				}
+			}
+
+			// バッチをワーカー数に分割して並列に勾配を計算する
+			batchLoss, batchCorrect := trainParallel(replicas, l, batchInputs, batchOutputs)
+			batchLoss += penalty(params) * float64(len(batchInputs))
+			totalLoss += batchLoss
+			correct += batchCorrect
+
+			// 勾配クリッピング
+			if config.ClipValue > 0 {
+				clipByValue(params, config.ClipValue)
+			}
+			if config.ClipNorm > 0 {
+				clipByGlobalNorm(params, config.ClipNorm)
+			}
+
+			// Update weights and biases
+			if config.Scheduler != nil {
+				point.Epoch = epoch
+				config.Optimizer.SetLearningRate(config.Scheduler.Rate(baseRate, point))
+			}
+			config.Optimizer.Step(params)
+			s.ZeroGrad()
+			s.mu.Unlock()
+			point.Step++
+
+			for _, c := range callbacks {
+				c.OnBatchEnd(epoch, batch, batchLoss/float64(len(batchInputs)))
+			}
+		}
+
+		// トレーニングセット全体に対する平均損失と正答率を記録する
+		metrics := EpochMetrics{
+			Epoch:        epoch,
+			Loss:         totalLoss / float64(len(inputs)),
+			Accuracy:     float64(correct) / float64(len(inputs)) * 100.0,
+			LearningRate: config.Optimizer.GetLearningRate(),
+		}
+		monitored := metrics.Loss
+		if len(validationInputs) > 0 {
+			metrics.HasValidation = true
+			s.mu.RLock()
+			metrics.ValidationLoss, metrics.ValidationAccuracy = s.evaluate(l, validationInputs, validationOutputs)
+			s.mu.RUnlock()
+			monitored = metrics.ValidationLoss
+		}
+		history.Epochs = append(history.Epochs, metrics)
+		if o, ok := config.Scheduler.(LossObserver); ok {
+			o.ObserveLoss(monitored)
+		}
+
+		// 監視する損失が改善した場合は最良のエポックとして記録する
+		stop := false
+		if history.BestEpoch < 0 || monitored < bestLoss-config.MinDelta {
+			history.BestEpoch = epoch
+			bestLoss = monitored
+			if config.RestoreBestWeights {
+				best = s.copyParams(best)
+			}
+		} else if config.Patience > 0 && epoch-history.BestEpoch >= config.Patience {
+			stop = true
+		}
+
+		for _, c := range callbacks {
+			if c.OnEpochEnd(metrics) {
+				stop = true
+			}
+		}
+		if stop {
+			break
+		}
+	}
+
+	if config.RestoreBestWeights && best != nil {
+		s.restoreParams(best)
+	}
+
+	for _, c := range callbacks {
+		c.OnTrainEnd(history)
+	}
+	return history, nil
+}
+
+// Evaluate returns the average loss of the model over inputs and outputs and
+// the percentage of samples whose largest output matches a target of 1.
+func (s *Sequential) Evaluate(inputs, outputs [][]float64) (float64, float64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.evaluate(s.lossFunction(), inputs, outputs)
+}
+
+func (s *Sequential) evaluate(l Loss, inputs, outputs [][]float64) (float64, float64) {
+	if len(inputs) == 0 {
+		return 0, 0
+	}
+	total := 0.0
+	correct := 0
+	for n, prediction := range s.predict(inputs) {
+		total += l.Value(prediction, outputs[n])
+		if outputs[n][argmax(prediction)] == 1 {
+			correct++
+		}
+	}
+	return total / float64(len(inputs)), float64(correct) / float64(len(inputs)) * 100.0
+}
+
+// copyParams copies the parameter values and buffers of the model into dst,
+// allocating it when it is nil or of other shapes.
+func (s *Sequential) copyParams(dst [][][]float64) [][][]float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	values := s.values()
+	if !sameShapes(dst, values) {
+		dst = make([][][]float64, len(values))
+		for i, v := range values {
+			dst[i] = zerosLike(v)
+		}
+	}
+	for i, v := range values {
+		for j := range v {
+			copy(dst[i][j], v[j])
+		}
+	}
+	return dst
+}
+
+// restoreParams copies src, taken by copyParams, back into the model. It does
+// nothing if the layers have since been replaced by ones of other shapes.
+func (s *Sequential) restoreParams(src [][][]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := s.values()
+	if !sameShapes(src, values) {
+		return
+	}
+	for i, v := range values {
+		for j := range v {
+			copy(v[j], src[i][j])
+		}
+	}
+}
+
+func sameShapes(a, b [][][]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameShape(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameSlice reports whether a and b are the same slice rather than equal
+// ones.
+func sameSlice(a, b []Layer) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// values returns the parameter values followed by the buffers of the model.
+func (s *Sequential) values() [][][]float64 {
+	values := [][][]float64{}
+	for _, p := range s.Params() {
+		values = append(values, p.Value)
+	}
+	return append(values, s.Buffers()...)
+}
+
+// trainParallel splits a batch into contiguous shards, backpropagates every
+// shard on its own replica and sums the gradients into the first replica.
+func trainParallel(replicas []*Sequential, l Loss, inputs, outputs [][]float64) (float64, int) {
+	scale := 1 / float64(len(inputs))
+	if len(replicas) == 1 {
+		return replicas[0].trainStep(l, inputs, outputs, scale)
+	}
+
+	shard := shardSize(len(inputs), len(replicas))
+	losses := make([]float64, len(replicas))
+	corrects := make([]int, len(replicas))
+	wg := sync.WaitGroup{}
+	for w := range replicas {
+		start := w * shard
+		end := start + shard
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+		if start >= end {
+			continue
+		}
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			losses[w], corrects[w] = replicas[w].trainStep(l, inputs[start:end], outputs[start:end], scale)
+		}(w, start, end)
+	}
+	wg.Wait()
+
+	// ワーカー順に勾配を集約することで結果を決定的にする
+	params := replicas[0].Params()
+	total := losses[0]
+	correct := corrects[0]
+	for w := 1; w < len(replicas); w++ {
+		total += losses[w]
+		correct += corrects[w]
+		for p, param := range replicas[w].Params() {
+			for i := range param.Grad {
+				for j := range param.Grad[i] {
+					params[p].Grad[i][j] += param.Grad[i][j]
+					param.Grad[i][j] = 0
+				}
+			}
+		}
+	}
+	return total, correct
+}
+
+// replicas returns s followed by copies of it for the other workers, after
+// checking that n samples can be trained in batches of batchSize.
+func (s *Sequential) replicas(n, batchSize, workers int) ([]*Sequential, error) {
+	if err := s.checkBatchNorm(n, batchSize, workers); err != nil {
+		return nil, err
+	}
+	replicas := []*Sequential{s}
+	for len(replicas) < workers {
+		replica, err := s.replicate()
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, replica)
+	}
+	return replicas, nil
+}
+
+// shardSize returns the number of samples of a batch of n samples every worker
+// processes; the last shard holds the rest.
+func shardSize(n, workers int) int {
+	return (n + workers - 1) / workers
+}
+
+// checkBatchNorm returns an error if a BatchNorm layer of s, including one
+// wrapped by another layer such as TimeDistributed, would compute the
+// statistics of a single sample, whose variance is zero, in a batch or shard
+// when n samples are trained in batches of batchSize over workers.
+func (s *Sequential) checkBatchNorm(n, batchSize, workers int) error {
+	found := false
+	for _, layer := range s.Layers {
+		if hasBatchNorm(layer) {
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	sizes := []int{n % batchSize}
+	if n >= batchSize {
+		sizes = append(sizes, batchSize)
+	}
+	for _, size := range sizes {
+		if size == 0 {
+			continue
+		}
+		shard := shardSize(size, workers)
+		if last := size - shard*((size-1)/shard); last < 2 {
+			return fmt.Errorf("batch normalization needs at least 2 samples, but a batch of %d samples over %d workers has a shard of %d", size, workers, last)
+		}
+	}
+	return nil
+}
+
+// hasBatchNorm reports whether layer is or wraps a BatchNorm layer.
+func hasBatchNorm(layer Layer) bool {
+	for {
+		if _, ok := layer.(*BatchNorm); ok {
+			return true
+		}
+		w, ok := layer.(wrapper)
+		if !ok {
+			return false
+		}
+		layer = w.wrapped()
+	}
+}
+
+// trainStep runs the forward and backward pass for a batch and returns its
+// summed loss and the number of correctly classified samples.
+func (s *Sequential) trainStep(l Loss, inputs, outputs [][]float64, scale float64) (float64, int) {
+	predictions := s.forward(inputs)
+
+	// 正解数をカウントする
+	correct := 0
+	for n, prediction := range predictions {
+		if outputs[n][argmax(prediction)] == 1 {
+			correct++
+		}
+	}
+
+	return s.backwardLoss(l, predictions, outputs, scale), correct
+}
+
+func argmax(values []float64) int {
+	best := 0
+	for i, v := range values {
+		if v > values[best] {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,114 @@
+package gonn
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestTrainWithoutSamples(t *testing.T) {
+	nn := NewNeuralNetworkRand(2, 3, 1, "relu-sigmoid", rand.New(rand.NewSource(1)))
+	before := nn.copyParams(nil)
+
+	// 従来どおり、サンプルがなければ何もせずに戻る
+	nn.TrainNeuralNetwork(nil, nil, 0.1, 10)
+	if after := nn.copyParams(nil); !reflect.DeepEqual(after, before) {
+		t.Error("TrainNeuralNetwork without samples changed the weights")
+	}
+	if _, err := nn.Fit(nil, nil, TrainConfig{Epochs: 1, Optimizer: NewSGD(0.1), Logger: NoLogger}); err == nil {
+		t.Error("Fit without samples returned no error")
+	}
+}
+
+func TestFitChecksBatchNormBatchSize(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		layer     func() Layer
+		batchSize int
+		workers   int
+		ok        bool
+	}{
+		{"single sample", func() Layer { return NewBatchNorm(2) }, 1, 1, false},
+		{"shards of two samples", func() Layer { return NewBatchNorm(2) }, 4, 2, true},
+		{"single sample last shard", func() Layer { return NewBatchNorm(2) }, 5, 2, false},
+		{"remainder batch", func() Layer { return NewBatchNorm(2) }, 7, 1, false},
+		{"two samples", func() Layer { return NewBatchNorm(2) }, 2, 1, true},
+		{"wrapped single sample", func() Layer { return NewTimeDistributed(NewBatchNorm(2), 2) }, 1, 1, false},
+		{"wrapped single sample shard", func() Layer { return NewTimeDistributed(NewBatchNorm(2), 2) }, 2, 2, false},
+		{"wrapped two samples", func() Layer { return NewTimeDistributed(NewBatchNorm(2), 2) }, 4, 2, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			model := NewSequential(c.layer(), NewDenseRand(2, 2, mustActivation(t, "sigmoid"), rng))
+			// 8 サンプルなので、バッチサイズ 7 では最後のバッチが 1 サンプルになる
+			inputs := randomInputs(rng, 8, 2)
+			_, err := model.Fit(inputs, randomTargets(rng, model, inputs), TrainConfig{
+				Epochs:    1,
+				Optimizer: NewSGD(0.1),
+				BatchSize: c.batchSize,
+				Workers:   c.workers,
+				Logger:    NoLogger,
+			})
+			if (err == nil) != c.ok {
+				t.Errorf("Fit returned %v", err)
+			}
+		})
+	}
+}
+
+// identity is a layer without a Replicate method.
+type identity struct{}
+
+func (identity) Forward(inputs [][]float64) [][]float64 { return inputs }
+func (identity) Backward(grads [][]float64) [][]float64 { return grads }
+func (identity) Params() []*Param                       { return nil }
+
+func TestFitChecksReplicator(t *testing.T) {
+	for name, layer := range map[string]Layer{
+		"layer":   identity{},
+		"wrapped": NewTimeDistributed(identity{}, 2),
+	} {
+		t.Run(name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			model := NewSequential(layer, NewDenseRand(2, 2, mustActivation(t, "sigmoid"), rng))
+			inputs := randomInputs(rng, 8, 2)
+			config := TrainConfig{Epochs: 1, Optimizer: NewSGD(0.1), BatchSize: 4, Logger: NoLogger}
+			if _, err := model.Fit(inputs, randomTargets(rng, model, inputs), config); err != nil {
+				t.Fatalf("Fit with 1 worker returned %v", err)
+			}
+			// 複製できない層を並列に学習しようとすると、パニックではなくエラーになる
+			config.Workers = 2
+			if _, err := model.Fit(inputs, randomTargets(rng, model, inputs), config); err == nil {
+				t.Error("Fit with 2 workers returned no error")
+			}
+		})
+	}
+}
+
+func TestFitRegularizesTouchedEmbeddingRows(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	embedding := NewEmbeddingRand(4, 3, rng)
+	vectors := embedding.Params()[0]
+	vectors.L1, vectors.L2 = 0.1, 0.1
+	model := NewSequential(embedding, NewDenseRand(6, 2, mustActivation(t, "sigmoid"), rng))
+	used := append([]float64(nil), vectors.Value[0]...)
+	unused := append([]float64(nil), vectors.Value[2]...)
+
+	// ID 2 を含まない入力では、ID 2 のベクトルは罰則項でも更新されない
+	inputs := [][]float64{{0, 1}, {3, 0}, {1, 3}, {0, 0}}
+	_, err := model.Fit(inputs, randomTargets(rng, model, inputs), TrainConfig{
+		Epochs:    5,
+		Optimizer: NewSGD(0.1),
+		BatchSize: 2,
+		Logger:    NoLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vectors.Value[2], unused) {
+		t.Errorf("vector of an unused ID changed from %v to %v", unused, vectors.Value[2])
+	}
+	if reflect.DeepEqual(vectors.Value[0], used) {
+		t.Error("vectors of used IDs were not trained")
+	}
+}